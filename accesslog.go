@@ -0,0 +1,313 @@
+package mcgoweb
+
+import (
+	stdcontext "context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AccessLogCommon, AccessLogCombined and AccessLogJSON are the
+// formats written by an access log.  All formats are written
+// through the configured slog.Logger, the Common and Combined Log
+// Formats as the message of a record without attributes, which
+// NewAccessLogLineHandler writes as a plain line.  The JSON format
+// is written as a record with the request's fields as attributes.
+const (
+	AccessLogCommon   = "common"
+	AccessLogCombined = "combined"
+	AccessLogJSON     = "json"
+)
+
+// AccessLogRedacted replaces the values of redacted headers and
+// query parameters in access logs.
+const AccessLogRedacted = "[REDACTED]"
+
+// DefaultAccessLogRedactHeaders and DefaultAccessLogRedactQuery are
+// redacted by access logs whose configuration leaves RedactHeaders
+// or RedactQuery nil.  Set an empty list to redact nothing.
+var DefaultAccessLogRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+var DefaultAccessLogRedactQuery = []string{"password", "token", "access_token", "code"}
+
+// AccessLogConfiguration represents the configuration of an access
+// log.  Logger defaults to writing to standard output, as plain
+// lines for the Common and Combined Log Formats and as JSON for
+// the JSON format.
+//
+// SampleRate is the fraction of requests logged, between 0 and 1,
+// with 0 logging every request.  Server errors are always logged.
+// Headers lists request headers added to JSON records.
+//
+// Blueprints enables or disables logging for the handlers of
+// blueprints by namespace, such as "api" or "api.admin".  The
+// setting of the innermost blueprint listed applies, and handlers
+// of blueprints not listed are logged.
+type AccessLogConfiguration struct {
+	Format        string
+	Logger        *slog.Logger
+	SampleRate    float64
+	Headers       []string
+	RedactHeaders []string
+	RedactQuery   []string
+	Blueprints    map[string]bool
+}
+
+// NewAccessLogConfiguration returns an access log configuration for
+// the format writing to standard output.
+func NewAccessLogConfiguration(format string) AccessLogConfiguration {
+	return AccessLogConfiguration{
+		Format:        format,
+		RedactHeaders: DefaultAccessLogRedactHeaders,
+		RedactQuery:   DefaultAccessLogRedactQuery,
+	}
+}
+
+// SetAccessLog sets the access log of the application, which logs
+// every request once it has been handled, including requests which
+// match no route or are redirected.
+func (app *HTTPApplication) SetAccessLog(configuration AccessLogConfiguration) {
+	app.accessLog = newAccessLog(configuration)
+}
+
+// NewAccessLogMiddleware returns a middleware logging each request
+// handled by the handlers it is added to.  Requests which match no
+// route are not logged, see Middleware, so use SetAccessLog to log
+// every request to an application.
+func NewAccessLogMiddleware(configuration AccessLogConfiguration) Middleware {
+	access_log := newAccessLog(configuration)
+	return func(handler RequestHandler, context *RequestContext) {
+		if context.Response() == nil {
+			context.response = NewResponseWriter(context.Writer)
+			context.Writer = context.response
+		}
+		defer access_log.log(context, time.Now())
+		handler(context)
+	}
+}
+
+func newAccessLog(configuration AccessLogConfiguration) *AccessLogConfiguration {
+	switch configuration.Format {
+	case AccessLogCommon, AccessLogCombined:
+		if configuration.Logger == nil {
+			configuration.Logger = slog.New(NewAccessLogLineHandler(os.Stdout))
+		}
+	case AccessLogJSON:
+		if configuration.Logger == nil {
+			configuration.Logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+		}
+	default:
+		panic(fmt.Sprintf("mcgoweb: unknown access log format %q", configuration.Format))
+	}
+	if configuration.RedactHeaders == nil {
+		configuration.RedactHeaders = DefaultAccessLogRedactHeaders
+	}
+	if configuration.RedactQuery == nil {
+		configuration.RedactQuery = DefaultAccessLogRedactQuery
+	}
+	return &configuration
+}
+
+// log logs the request started at the given time once handled.
+func (configuration *AccessLogConfiguration) log(context *RequestContext, start time.Time) {
+	latency := time.Since(start)
+	if !configuration.enabled(context) {
+		return
+	}
+	var status int
+	var bytes_written int64
+	if context.response != nil {
+		status, bytes_written = context.response.Status(), context.response.BytesWritten()
+	}
+	if status == 0 {
+		status = 200
+	}
+	if status < 500 && configuration.SampleRate > 0 && rand.Float64() >= configuration.SampleRate {
+		return
+	}
+	if configuration.Format == AccessLogJSON {
+		configuration.logRecord(context, start, latency, status, bytes_written)
+	} else {
+		configuration.logLine(context, start, status, bytes_written)
+	}
+}
+
+func (configuration *AccessLogConfiguration) enabled(context *RequestContext) bool {
+	if context.route == nil || len(configuration.Blueprints) == 0 {
+		return true
+	}
+	for namespace := context.route.namespace; namespace != ""; {
+		if enabled, ok := configuration.Blueprints[namespace]; ok {
+			return enabled
+		}
+		if i := strings.LastIndexByte(namespace, '.'); i >= 0 {
+			namespace = namespace[:i]
+		} else {
+			namespace = ""
+		}
+	}
+	return true
+}
+
+// logLine logs the request in the Common or Combined Log Format.
+func (configuration *AccessLogConfiguration) logLine(context *RequestContext, start time.Time, status int, bytes_written int64) {
+	size := "-"
+	if bytes_written > 0 {
+		size = fmt.Sprint(bytes_written)
+	}
+	line := fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s",
+		logField(context.ClientIP()),
+		logField(accessLogUser(context)),
+		start.Format("02/Jan/2006:15:04:05 -0700"),
+		context.Request.Method,
+		configuration.redactURL(context.Request.URL),
+		context.Request.Proto,
+		status,
+		size)
+	if configuration.Format == AccessLogCombined {
+		line += fmt.Sprintf(" %q %q", logField(context.Request.Referer()), logField(context.Request.UserAgent()))
+	}
+	configuration.Logger.LogAttrs(context.Request.Context(), accessLogLevel(status), line)
+}
+
+func (configuration *AccessLogConfiguration) logRecord(context *RequestContext, start time.Time, latency time.Duration, status int, bytes_written int64) {
+	attributes := []slog.Attr{
+		slog.String("method", context.Request.Method),
+		slog.String("url", configuration.redactURL(context.Request.URL)),
+		slog.Int("status", status),
+		slog.Int64("bytes", bytes_written),
+		slog.Duration("latency", latency),
+		slog.String("client_ip", context.ClientIP()),
+	}
+	if context.route != nil {
+		attributes = append(attributes, slog.String("route", context.route.Path))
+		if context.route.Name != "" {
+			attributes = append(attributes, slog.String("route_name", context.route.Name))
+		}
+	}
+	if len(context.RequestVars) > 0 {
+		vars := make([]any, 0, len(context.RequestVars))
+		for name, value := range context.RequestVars {
+			vars = append(vars, slog.String(name, value))
+		}
+		attributes = append(attributes, slog.Group("vars", vars...))
+	}
+	if request_id := context.RequestID(); request_id != "" {
+		attributes = append(attributes, slog.String("request_id", request_id))
+	}
+	if user := accessLogUser(context); user != "" {
+		attributes = append(attributes, slog.String("user", user))
+	}
+	if len(configuration.Headers) > 0 {
+		var headers []any
+		for _, name := range configuration.Headers {
+			if value := context.Request.Header.Get(name); value != "" {
+				if configuration.redactHeader(name) {
+					value = AccessLogRedacted
+				}
+				headers = append(headers, slog.String(strings.ToLower(name), value))
+			}
+		}
+		if len(headers) > 0 {
+			attributes = append(attributes, slog.Group("headers", headers...))
+		}
+	}
+
+	configuration.Logger.LogAttrs(context.Request.Context(), accessLogLevel(status), "request", attributes...)
+}
+
+func accessLogLevel(status int) slog.Level {
+	if status >= 500 {
+		return slog.LevelError
+	} else if status >= 400 {
+		return slog.LevelWarn
+	}
+	return slog.LevelInfo
+}
+
+// accessLogLineHandler is a slog.Handler writing the message of
+// each record as a line.
+type accessLogLineHandler struct {
+	lock   *sync.Mutex
+	writer io.Writer
+}
+
+// NewAccessLogLineHandler returns a slog.Handler writing only the
+// message of each record as a line, for access logs in the Common
+// or Combined Log Format.
+func NewAccessLogLineHandler(writer io.Writer) slog.Handler {
+	return &accessLogLineHandler{lock: new(sync.Mutex), writer: writer}
+}
+
+func (handler *accessLogLineHandler) Enabled(stdcontext.Context, slog.Level) bool {
+	return true
+}
+
+func (handler *accessLogLineHandler) Handle(_ stdcontext.Context, record slog.Record) error {
+	handler.lock.Lock()
+	defer handler.lock.Unlock()
+	_, err := io.WriteString(handler.writer, record.Message+"\n")
+	return err
+}
+
+func (handler *accessLogLineHandler) WithAttrs([]slog.Attr) slog.Handler {
+	return handler
+}
+
+func (handler *accessLogLineHandler) WithGroup(string) slog.Handler {
+	return handler
+}
+
+func (configuration *AccessLogConfiguration) redactHeader(name string) bool {
+	for _, redacted := range configuration.RedactHeaders {
+		if strings.EqualFold(redacted, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactURL returns the request URI with the values of redacted
+// query parameters replaced.
+func (configuration *AccessLogConfiguration) redactURL(request_url *url.URL) string {
+	uri := request_url.RequestURI()
+	if request_url.RawQuery == "" || len(configuration.RedactQuery) == 0 {
+		return uri
+	}
+	query := request_url.Query()
+	redacted := false
+	for name := range query {
+		for _, redact := range configuration.RedactQuery {
+			if strings.EqualFold(redact, name) {
+				for i := range query[name] {
+					query[name][i] = AccessLogRedacted
+				}
+				redacted = true
+			}
+		}
+	}
+	if !redacted {
+		return uri
+	}
+	return strings.SplitN(uri, "?", 2)[0] + "?" + query.Encode()
+}
+
+func accessLogUser(context *RequestContext) string {
+	if context.Session == nil {
+		return ""
+	}
+	user, _ := context.Session.GetValue("user")
+	return user
+}
+
+func logField(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,117 @@
+package mcgoweb
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func newAccessLogTestApp(t *testing.T, configuration AccessLogConfiguration) *HTTPApplication {
+	app := NewHTTPApplication("Access Log Test", "/", "0.0.0.0:7654")
+	app.SetAccessLog(configuration)
+	handler := NewHandler("/files/<name>", HTTP_GET)
+	handler.Name = "file"
+	handler.RequestHandler = func(context *RequestContext) {
+		context.Writer.Write([]byte("contents"))
+	}
+	if _, err := app.RegisterHandler(handler); err != nil {
+		t.Fatalf("Unexpected error registering handler: %s", err)
+	}
+
+	blueprint := NewBlueprint("/health")
+	blueprint.Name = "health"
+	check := NewHandler("/", HTTP_GET)
+	check.RequestHandler = func(context *RequestContext) {}
+	blueprint.RegisterHandler(check)
+	if _, err := app.RegisterBlueprint(blueprint); err != nil {
+		t.Fatalf("Unexpected error registering blueprint: %s", err)
+	}
+	return app
+}
+
+func TestAccessLogCombined(t *testing.T) {
+	var output bytes.Buffer
+	configuration := NewAccessLogConfiguration(AccessLogCombined)
+	configuration.Logger = slog.New(NewAccessLogLineHandler(&output))
+	configuration.Blueprints = map[string]bool{"health": false}
+	app := newAccessLogTestApp(t, configuration)
+
+	request := createTestRequest("/files/a.txt?token=secret&page=2")
+	request.Header = map[string][]string{"User-Agent": {"tester"}}
+	request.RemoteAddr = "192.0.2.1:1234"
+	request.Proto = "HTTP/1.1"
+	app.ServeHTTP(httptest.NewRecorder(), request)
+	app.ServeHTTP(httptest.NewRecorder(), createTestRequest("/health"))
+	app.ServeHTTP(httptest.NewRecorder(), createTestRequest("/missing"))
+
+	expected := regexp.MustCompile(`^192\.0\.2\.1 - - \[[^\]]+\] "GET /files/a\.txt\?page=2&token=%5BREDACTED%5D HTTP/1\.1" 200 8 "-" "tester"\n` +
+		`- - - \[[^\]]+\] "GET /missing " 404 19 "-" "-"\n$`)
+	if actual := output.String(); !expected.MatchString(actual) {
+		t.Errorf("Unexpected access log\nExpected: '%s'\nActual:   '%s'", expected, actual)
+	}
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	var output bytes.Buffer
+	// Redaction lists left nil use the defaults.
+	app := newAccessLogTestApp(t, AccessLogConfiguration{
+		Format:  AccessLogJSON,
+		Logger:  slog.New(slog.NewJSONHandler(&output, nil)),
+		Headers: []string{"Authorization", "User-Agent"},
+	})
+
+	request := createTestRequest("/files/a.txt?token=secret")
+	request.Header = map[string][]string{"Authorization": {"Bearer secret"}, "User-Agent": {"tester"}}
+	app.ServeHTTP(httptest.NewRecorder(), request)
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(output.Bytes(), &record); err != nil {
+		t.Fatalf("Unable to decode access log record %q: %s", output.String(), err)
+	}
+	for name, expected := range map[string]interface{}{
+		"method":     "GET",
+		"route":      "/files/<name>",
+		"route_name": "file",
+		"status":     float64(200),
+		"bytes":      float64(8),
+	} {
+		if actual := record[name]; actual != expected {
+			t.Errorf("Unexpected %s in access log: %v, expected %v", name, actual, expected)
+		}
+	}
+	if vars, _ := record["vars"].(map[string]interface{}); vars["name"] != "a.txt" {
+		t.Errorf("Unexpected vars in access log: %v", record["vars"])
+	}
+	headers, _ := record["headers"].(map[string]interface{})
+	if headers["authorization"] != AccessLogRedacted || headers["user-agent"] != "tester" {
+		t.Errorf("Unexpected headers in access log: %v", record["headers"])
+	}
+	if strings.Contains(output.String(), "secret") {
+		t.Errorf("Access log contains redacted value: %s", output.String())
+	}
+}
+
+func TestAccessLogMiddleware(t *testing.T) {
+	var output bytes.Buffer
+	configuration := NewAccessLogConfiguration(AccessLogCommon)
+	configuration.Logger = slog.New(NewAccessLogLineHandler(&output))
+	blueprint := NewBlueprint("/api")
+	blueprint.AddMiddleware(NewAccessLogMiddleware(configuration))
+	handler := NewHandler("/", HTTP_GET)
+	handler.RequestHandler = func(context *RequestContext) {}
+	blueprint.RegisterHandler(handler)
+	app := NewHTTPApplication("Access Log Test", "/", "0.0.0.0:7654")
+	if _, err := app.RegisterBlueprint(blueprint); err != nil {
+		t.Fatalf("Unexpected error registering blueprint: %s", err)
+	}
+
+	app.ServeHTTP(httptest.NewRecorder(), createTestRequest("/api"))
+	app.ServeHTTP(httptest.NewRecorder(), createTestRequest("/other"))
+	if lines := strings.Count(output.String(), "\n"); lines != 1 || !strings.Contains(output.String(), `"GET /api " 200 -`) {
+		t.Errorf("Unexpected access log from middleware: %q", output.String())
+	}
+}
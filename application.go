@@ -2,152 +2,475 @@ package mcgoweb
 
 import (
 	"encoding/json"
+	"html/template"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // HTTPApplications represents a configuration for
 // an HTTPApplication.  This configuration can be
 // manually configured or created from a file
+//
+// The timeouts and MaxHeaderBytes configure the server
+// started by Run, zero values use the net/http defaults.
+// TrustedProxies lists the CIDR networks or addresses of proxies
+// whose forwarding headers are used to resolve the client.
+//
+// CleanPath redirects requests for paths with repeated slashes or
+// dot segments to the cleaned path.  TrailingSlash sets how paths
+// differing only by a trailing slash are handled, and
+// CaseInsensitive matches routes regardless of case.
+//
+// RequestIDs assigns every request an ID as RequestIDMiddleware
+// does, including requests which match no route or are redirected.
 type HTTPApplicationConfiguration struct {
-	Name         string
-	Root         string
-	BindLocation string
+	Name           string
+	Root           string
+	BindLocation   string
+	TrustedProxies []string
+
+	CleanPath       bool
+	TrailingSlash   string
+	CaseInsensitive bool
+	RequestIDs      bool
+
+	ReadHeaderTimeout Duration
+	ReadTimeout       Duration
+	WriteTimeout      Duration
+	IdleTimeout       Duration
+	MaxHeaderBytes    int
 }
 
+// Duration represents a time.Duration in a configuration.
+// In JSON it may be given as a string such as "30s" or as a
+// number of nanoseconds.
+type Duration time.Duration
+
+// DefaultReadHeaderTimeout and DefaultIdleTimeout are used by new
+// application configurations, protecting against clients which
+// hold connections open without sending requests.
+var DefaultReadHeaderTimeout Duration = Duration(10 * time.Second)
+var DefaultIdleTimeout Duration = Duration(2 * time.Minute)
+
 // HTTPApplication represents an application that will
 // server HTTP requests.
 type HTTPApplication struct {
 	NotFoundHandler RequestHandler
 
-	configuration HTTPApplicationConfiguration
-	middleware    []Middleware
-	routes        []*Route
-	sessionCache  SessionCache
+	configuration  HTTPApplicationConfiguration
+	trustedProxies []*net.IPNet
+	middleware     []Middleware
+	routes         atomic.Pointer[routeTable]
+	routesLock     sync.Mutex
+	sessionCache   SessionCache
+	loginTracker   *LoginAttemptTracker
+	errorHandlers  map[int]ErrorHandler
+	templates      *template.Template
+	metrics        *Metrics
+	tracer         *Tracer
+	accessLog      *AccessLogConfiguration
 }
 
 // ServerHTTP dispatches requests to the matching
 // registered handler or responds in error
 func (app *HTTPApplication) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
 	context := new(RequestContext)
-	context.Request = request
-	context.Writer = writer
+	context.Request = withRequestContext(request, context)
+	context.response = NewResponseWriter(writer)
+	context.Writer = context.response
+	context.afterRequest = new(afterRequest)
+	context.valueStore()
 	context.sessionCache = app.sessionCache
+	context.loginTracker = app.loginTracker
+	context.trustedProxies = app.trustedProxies
+	context.application = app
+	defer context.runAfterRequest()
+	if app.configuration.RequestIDs {
+		context.assignRequestID()
+	}
+	if app.accessLog != nil {
+		defer app.accessLog.log(context, time.Now())
+	}
+	if app.metrics != nil {
+		defer app.metrics.end(context, app.metrics.begin())
+	}
+	if app.tracer != nil {
+		defer app.tracer.traceRequest(context)()
+	}
 	app.dispatch(context)
 }
 
 // NewHTTPApplicationFromJSONFile returns a new HTTPApplication configured
 // using the given configuration file.
 func NewHTTPApplicationFromJSONFile(config_file string) *HTTPApplication {
-	application := new(HTTPApplication)
+	configuration := NewHTTPApplicationConfiguration("", "/", "")
 	if contents, err := ioutil.ReadFile(config_file); err == nil {
-		if json_err := json.Unmarshal(contents, &application.configuration); err != nil {
+		if json_err := json.Unmarshal(contents, &configuration); json_err != nil {
 			panic(json_err)
 		}
 	} else {
 		panic(err)
 	}
-	return application
+	return NewHTTPApplicationFromConfiguration(configuration)
 }
 
 // NewHTTPApplicaton returns a new HTTPApplication using the given
 // name, root path, and bind location as the configuration.
 func NewHTTPApplication(name, root, bind_location string) *HTTPApplication {
+	return NewHTTPApplicationFromConfiguration(NewHTTPApplicationConfiguration(name, root, bind_location))
+}
+
+// NewHTTPApplicationFromConfiguration returns a new HTTPApplication
+// using the given configuration.
+func NewHTTPApplicationFromConfiguration(configuration HTTPApplicationConfiguration) *HTTPApplication {
 	application := new(HTTPApplication)
-	application.configuration.Name = name
-	application.configuration.Root = root
-	application.configuration.BindLocation = bind_location
+	application.configuration = configuration
+	trusted_proxies, err := parseNetworks(configuration.TrustedProxies)
+	if err != nil {
+		panic(err)
+	}
+	application.trustedProxies = trusted_proxies
+	switch configuration.TrailingSlash {
+	case "", TrailingSlashStrict, TrailingSlashRedirect:
+	default:
+		panic("mcgoweb: unknown trailing slash mode " + configuration.TrailingSlash)
+	}
 	return application
 }
 
+// NewHTTPApplicationConfiguration returns a configuration with the
+// given name, root path, and bind location, using default values
+// for the server timeouts.
+func NewHTTPApplicationConfiguration(name, root, bind_location string) HTTPApplicationConfiguration {
+	return HTTPApplicationConfiguration{
+		Name:              name,
+		Root:              root,
+		BindLocation:      bind_location,
+		ReadHeaderTimeout: DefaultReadHeaderTimeout,
+		IdleTimeout:       DefaultIdleTimeout,
+	}
+}
+
 // Run binds the application to the configured location and
 // serves requests indefinately.
 func (app *HTTPApplication) Run() {
-	log.Fatal(http.ListenAndServe(app.configuration.BindLocation, app))
+	server := &http.Server{
+		Addr:              app.configuration.BindLocation,
+		Handler:           app,
+		ReadHeaderTimeout: time.Duration(app.configuration.ReadHeaderTimeout),
+		ReadTimeout:       time.Duration(app.configuration.ReadTimeout),
+		WriteTimeout:      time.Duration(app.configuration.WriteTimeout),
+		IdleTimeout:       time.Duration(app.configuration.IdleTimeout),
+		MaxHeaderBytes:    app.configuration.MaxHeaderBytes,
+	}
+	log.Fatal(server.ListenAndServe())
+}
+
+// UnmarshalJSON reads a duration from a string or a number
+// of nanoseconds.
+func (duration *Duration) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch value := value.(type) {
+	case float64:
+		*duration = Duration(value)
+	case string:
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*duration = Duration(parsed)
+	default:
+		return &json.UnmarshalTypeError{Value: string(data), Type: reflect.TypeOf(*duration)}
+	}
+	return nil
+}
+
+// MarshalJSON writes a duration as a string.
+func (duration Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(duration).String())
 }
 
 // AddRoute registers a handler given the path, handler function,
 // and HTTP methods.
-func (app *HTTPApplication) AddRoute(path string, handler RequestHandler, methods HTTPMethods) {
-	app.routes = append(app.routes, newRoute(path, handler, methods))
+func (app *HTTPApplication) AddRoute(path string, handler RequestHandler, methods HTTPMethods) (*Registration, error) {
+	route, err := newRoute(path, handler, methods)
+	if err != nil {
+		return nil, err
+	}
+	return app.addRoutes([]*Route{route})
+}
+
+// AddMiddleware adds a middleware function to the application to
+// be called before any blueprint or handler middleware.  Only
+// handlers registered after the middleware is added will use it.
+func (app *HTTPApplication) AddMiddleware(middleware Middleware) {
+	app.middleware = append(app.middleware, middleware)
 }
 
 // Register generates a handler using the given generator function
 // and registers it with the application.
-func (app *HTTPApplication) Register(generator HandlerGenerator) {
-	app.RegisterHandler(generator())
+func (app *HTTPApplication) Register(generator HandlerGenerator) (*Registration, error) {
+	return app.RegisterHandler(generator())
 }
 
-// RegisterHandler registers a handler with the application.
-func (app *HTTPApplication) RegisterHandler(handler *Handler) {
-	// Create middleware chain
-	middleware_chain := make([]Middleware, len(handler.Middleware)+len(app.middleware))
-	i := 0
-	for _, middleware := range app.middleware {
-		middleware_chain[i] = middleware
-		i++
-	}
-	for _, middleware := range handler.Middleware {
-		middleware_chain[i] = middleware
-		i++
+// RegisterHandler registers a handler with the application,
+// returning a registration which can later remove it.  Routes are
+// matched from the most specific, independent of the order handlers
+// are registered.  An error is returned for an invalid path or host
+// pattern, a duplicate name, or a route which matches the same
+// requests as an existing route.  Handlers may be registered while
+// the application is serving requests.
+func (app *HTTPApplication) RegisterHandler(handler *Handler) (*Registration, error) {
+	route, err := app.newHandlerRoute(handler, nil)
+	if err != nil {
+		return nil, err
 	}
+	return app.addRoutes([]*Route{route})
+}
 
-	request_handler := handler.RequestHandler.withMiddlewareChain(middleware_chain)
-	request_path := path.Join(app.configuration.Root, handler.Path)
-	route := newRoute(request_path, request_handler, handler.HTTPMethods)
-	app.routes = append(app.routes, route)
+// RegisterBlueprint registers a blueprint, and any blueprints
+// nested within it, to this application.  Either every handler is
+// registered or, on error, none are.
+func (app *HTTPApplication) RegisterBlueprint(blueprint *Blueprint) (*Registration, error) {
+	routes, err := app.newBlueprintRoutes(blueprint, nil)
+	if err != nil {
+		return nil, err
+	}
+	return app.addRoutes(routes)
 }
 
-// RegisterBlueprint registers a blueprint to this application.
-func (app *HTTPApplication) RegisterBlueprint(blueprint *Blueprint) {
+func (app *HTTPApplication) newBlueprintRoutes(blueprint *Blueprint, routes []*Route) ([]*Route, error) {
 	for _, handler := range blueprint.Handlers {
-		// Create middleware chain
-		middleware_count := len(handler.Middleware) + len(blueprint.Middleware) + len(app.middleware)
-		middleware_chain := make([]Middleware, middleware_count)
-		i := 0
-		for _, middleware := range app.middleware {
-			middleware_chain[i] = middleware
-			i++
+		route, err := app.newHandlerRoute(handler, blueprint)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, route)
+	}
+	for _, nested := range blueprint.Blueprints {
+		var err error
+		if routes, err = app.newBlueprintRoutes(nested, routes); err != nil {
+			return nil, err
+		}
+	}
+	return routes, nil
+}
+
+// newHandlerRoute returns the route for a handler of the blueprint,
+// with the middleware chain and settings of the application and
+// blueprints applied.
+func (app *HTTPApplication) newHandlerRoute(handler *Handler, blueprint *Blueprint) (*Route, error) {
+	lineage := blueprint.lineage()
+
+	// Create middleware chain
+	middleware_chain := make([]Middleware, 0, len(app.middleware)+len(handler.Middleware)+2)
+	middleware_chain = append(middleware_chain, app.middleware...)
+	path_parts := []string{app.configuration.Root}
+	var namespace []string
+
+	// Inner blueprints override the values of outer blueprints
+	host, max_body_bytes, timeout, deadline := handler.Host, handler.MaxBodyBytes, handler.Timeout, handler.Deadline
+	for i := len(lineage) - 1; i >= 0; i-- {
+		if host == "" {
+			host = lineage[i].Host
+		}
+		if max_body_bytes == 0 {
+			max_body_bytes = lineage[i].MaxBodyBytes
+		}
+		if timeout == 0 {
+			timeout = lineage[i].Timeout
 		}
-		for _, middleware := range blueprint.Middleware {
-			middleware_chain[i] = middleware
-			i++
+		if deadline == 0 {
+			deadline = lineage[i].Deadline
 		}
-		for _, middleware := range handler.Middleware {
-			middleware_chain[i] = middleware
-			i++
+	}
+	if max_body_bytes > 0 {
+		middleware_chain = append(middleware_chain, MaxBodyBytesMiddleware(max_body_bytes))
+	}
+	if timeout > 0 {
+		middleware_chain = append(middleware_chain, TimeoutMiddleware(timeout))
+	}
+	if deadline > 0 {
+		middleware_chain = append(middleware_chain, DeadlineMiddleware(deadline))
+	}
+
+	var conditions []Condition
+	for _, parent := range lineage {
+		middleware_chain = append(middleware_chain, parent.Middleware...)
+		conditions = append(conditions, parent.Conditions...)
+		path_parts = append(path_parts, parent.Path)
+		if parent.Name != "" {
+			namespace = append(namespace, parent.Name)
 		}
+	}
+	middleware_chain = append(middleware_chain, handler.Middleware...)
+	// A trailing slash is kept unless the handler is at the root
+	// of its blueprint
+	request_path := path.Join(append(path_parts, handler.Path)...)
+	if len(handler.Path) > 1 && strings.HasSuffix(handler.Path, "/") && request_path != "/" {
+		request_path += "/"
+	}
 
-		request_handler := handler.RequestHandler.withMiddlewareChain(middleware_chain)
-		request_path := path.Join(app.configuration.Root, blueprint.Path, handler.Path)
-		route := newRoute(request_path, request_handler, handler.HTTPMethods)
-		app.routes = append(app.routes, route)
+	middleware_names := make([]string, len(middleware_chain))
+	timed_chain := make([]Middleware, len(middleware_chain))
+	for i, middleware := range middleware_chain {
+		middleware_names[i] = funcName(middleware)
+		timed_chain[i] = instrumentMiddleware(middleware, middleware_names[i])
+	}
+	request_handler := handler.RequestHandler.withMiddlewareChain(timed_chain)
+	route, err := newRoute(request_path, request_handler, handler.HTTPMethods)
+	if err != nil {
+		return nil, err
+	}
+	if host != "" {
+		if err := route.setHost(host); err != nil {
+			return nil, err
+		}
+	}
+	if handler.mount {
+		if err := route.setMount(); err != nil {
+			return nil, err
+		}
+	}
+	if app.configuration.CaseInsensitive {
+		route.setCaseInsensitive()
+	}
+	route.handlerName = funcName(handler.RequestHandler)
+	route.middlewareNames = middleware_names
+	route.conditions = append(conditions, handler.Conditions...)
+	route.consumes = handler.Consumes
+	route.produces = handler.Produces
+	route.namespace = strings.Join(namespace, ".")
+	route.blueprint = blueprint
+	if handler.Name != "" {
+		route.Name = handler.Name
+		if route.namespace != "" {
+			route.Name = route.namespace + "." + handler.Name
+		}
 	}
+	return route, nil
 }
 
+// Mount registers an http.Handler to serve every request for the
+// prefix and any path below it.  The prefix is stripped from the
+// request's path before it is passed to the handler.
+func (app *HTTPApplication) Mount(prefix string, handler http.Handler) (*Registration, error) {
+	return app.RegisterHandler(NewMountHandler(prefix, handler))
+}
 
 // SetSessionCache sets the cache to use for the application's sessions.
 func (app *HTTPApplication) SetSessionCache(cache SessionCache) {
 	app.sessionCache = cache
 }
 
+// SetErrorHandler sets the handler used to respond with the status
+// for requests whose blueprints have no handler for it.
+func (app *HTTPApplication) SetErrorHandler(status int, handler ErrorHandler) {
+	if app.errorHandlers == nil {
+		app.errorHandlers = make(map[int]ErrorHandler)
+	}
+	app.errorHandlers[status] = handler
+}
+
+// SetTemplates sets the templates rendered by Render when the
+// request's blueprints do not define the template.
+func (app *HTTPApplication) SetTemplates(templates *template.Template) {
+	app.templates = templates
+}
+
+// SetLoginAttemptTracker sets the tracker used to throttle login
+// attempts made through the request context.
+func (app *HTTPApplication) SetLoginAttemptTracker(tracker *LoginAttemptTracker) {
+	app.loginTracker = tracker
+}
+
 func (app *HTTPApplication) dispatch(context *RequestContext) {
-	for i := range app.routes {
-		if app.routes[i].matchesRequest(context) {
-			if app.routes[i].methodSupported(context) {
-				app.routes[i].Handler(context)
-				return
-			} else {
-				// Method not supported error
-				break
-			}
-		}
+	matched, status, location := app.resolve(context, app.routeTable())
+	if location != "" {
+		http.Redirect(context.Writer, context.Request, location, status)
+		return
 	}
-	if app.NotFoundHandler != nil {
+
+	context.RequestVars = nil
+	if matched != nil {
+		matched.matchesRequest(context)
+		context.route = matched
+		matched.Handler(context)
+		return
+	}
+	if status == http.StatusNotFound && app.NotFoundHandler != nil {
 		app.NotFoundHandler(context)
 	} else {
-		http.NotFound(context.Writer, context.Request)
+		context.Error(status)
+	}
+}
+
+// resolve returns the route chosen for the request, or the status
+// to respond with when none fits along with the location for a
+// redirect to the canonical path.
+func (app *HTTPApplication) resolve(context *RequestContext, table *routeTable) (*Route, int, string) {
+	context.routingPath = canonicalPath(context.Request.URL)
+	if app.configuration.CleanPath {
+		if cleaned := cleanPath(context.routingPath); cleaned != context.routingPath {
+			return nil, redirectStatus(context.Request.Method), redirectLocation(context.Request, cleaned)
+		}
+	}
+
+	matched, status := app.findRoute(context, table)
+	if matched == nil && status == http.StatusNotFound && app.configuration.TrailingSlash == TrailingSlashRedirect {
+		request_path := context.routingPath
+		context.routingPath = toggleTrailingSlash(request_path)
+		if route, _ := app.findRoute(context, table); route != nil {
+			return nil, redirectStatus(context.Request.Method), redirectLocation(context.Request, context.routingPath)
+		}
+		context.routingPath = request_path
 	}
+	return matched, status, ""
+}
+
+// findRoute returns the route chosen for the request, or the status
+// to respond with when none fits.
+func (app *HTTPApplication) findRoute(context *RequestContext, table *routeTable) (*Route, int) {
+	var matched *Route
+	var matched_quality float64
+	status := http.StatusNotFound
+	for i := range table.routes {
+		// Once a route is chosen only equivalent routes may produce
+		// a better media type for the request
+		if matched != nil && table.routes[i].signature() != matched.signature() {
+			break
+		}
+		if !table.routes[i].matchesRequest(context) || !table.routes[i].methodSupported(context) {
+			continue
+		}
+		route_status, quality := table.routes[i].checkConditions(context)
+		if route_status != http.StatusOK {
+			if conditionStatusPriority[route_status] > conditionStatusPriority[status] {
+				status = route_status
+			}
+			continue
+		}
+		if matched == nil || quality > matched_quality {
+			matched, matched_quality = table.routes[i], quality
+		}
+	}
+	return matched, status
+}
+
+// When no route fits a request the most specific failure is reported.
+var conditionStatusPriority = map[int]int{
+	http.StatusNotFound:             0,
+	http.StatusNotAcceptable:        1,
+	http.StatusUnsupportedMediaType: 2,
 }
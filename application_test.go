@@ -29,7 +29,9 @@ func TestHandling(t *testing.T) {
 	}
 
 	app := NewHTTPApplication("Blueprint Test", "/somewebapp/", "0.0.0.0:7654")
-	app.RegisterHandler(NewTestHandler())
+	if _, err := app.RegisterHandler(NewTestHandler()); err != nil {
+		t.Fatalf("Unexpected error registering handler: %s", err)
+	}
 
 	var response *httptest.ResponseRecorder
 
@@ -87,7 +89,9 @@ func TestMiddlewareOrdering(t *testing.T) {
 	}
 
 	app := NewHTTPApplication("Middleware Test", "/", "0.0.0.0:7654")
-	app.RegisterBlueprint(NewTestBlueprint())
+	if _, err := app.RegisterBlueprint(NewTestBlueprint()); err != nil {
+		t.Fatalf("Unexpected error registering blueprint: %s", err)
+	}
 
 	var response *httptest.ResponseRecorder
 
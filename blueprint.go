@@ -1,16 +1,44 @@
 package mcgoweb
 
-import ()
+import (
+	"html/template"
+	"net/http"
+	"time"
+)
 
 // Blueprint represents a sub-application at a sub-path of the
 // main application.  A blueprint can be defined and configured
-// before being attached to its parent application.
+// before being attached to its parent application or blueprint.
+//
+// The Name of a blueprint namespaces the names of its handlers.
+// A Host pattern restricts the blueprint's handlers to matching
+// hosts, capturing any host variables into the RequestVars.
+// MaxBodyBytes, Timeout and Deadline limit every handler in the
+// blueprint which does not set its own limits.  Conditions apply
+// to every handler in the blueprint in addition to their own.
+// Nested blueprints inherit these values, and error handlers and
+// templates, from their parents unless they set their own.
 type Blueprint struct {
-	Path       string
-	Handlers   []*Handler
-	Middleware []Middleware
+	Name          string
+	Path          string
+	Host          string
+	Handlers      []*Handler
+	Blueprints    []*Blueprint
+	Middleware    []Middleware
+	Conditions    []Condition
+	MaxBodyBytes  int64
+	Timeout       time.Duration
+	Deadline      time.Duration
+	ErrorHandlers map[int]ErrorHandler
+	Templates     *template.Template
+
+	parent *Blueprint
 }
 
+// ErrorHandler is a function definition for responding to a
+// request with an error status.
+type ErrorHandler func(context *RequestContext, status int)
+
 // NewBlueprint returns a new blueprint at the given path.
 func NewBlueprint(path string) *Blueprint {
 	return &Blueprint{Path: path}
@@ -27,6 +55,39 @@ func (blueprint *Blueprint) RegisterHandler(handler *Handler) {
 	blueprint.Handlers = append(blueprint.Handlers, handler)
 }
 
+// Mount registers an http.Handler to serve every request for the
+// prefix below the blueprint's path, as with the application's
+// Mount.
+func (blueprint *Blueprint) Mount(prefix string, handler http.Handler) {
+	blueprint.RegisterHandler(NewMountHandler(prefix, handler))
+}
+
+// RegisterBlueprint nests a blueprint within this blueprint.  The
+// nested blueprint's path is relative to this blueprint's path and
+// its handlers are called after this blueprint's middleware.
+func (blueprint *Blueprint) RegisterBlueprint(nested *Blueprint) {
+	nested.parent = blueprint
+	blueprint.Blueprints = append(blueprint.Blueprints, nested)
+}
+
+// SetErrorHandler sets the handler used by the blueprint's handlers,
+// and those of nested blueprints, to respond with the status.
+func (blueprint *Blueprint) SetErrorHandler(status int, handler ErrorHandler) {
+	if blueprint.ErrorHandlers == nil {
+		blueprint.ErrorHandlers = make(map[int]ErrorHandler)
+	}
+	blueprint.ErrorHandlers[status] = handler
+}
+
+// lineage returns the blueprint and its parents, outermost first.
+func (blueprint *Blueprint) lineage() []*Blueprint {
+	var blueprints []*Blueprint
+	for ; blueprint != nil; blueprint = blueprint.parent {
+		blueprints = append([]*Blueprint{blueprint}, blueprints...)
+	}
+	return blueprints
+}
+
 // AddMiddleware adds a middleware function to the blueprint to be
 // called after previously added middleware on each registered
 // blueprint handler.
@@ -1,7 +1,10 @@
 package mcgoweb
 
 import (
+	"html/template"
+	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -24,7 +27,9 @@ func TestBlueprint(t *testing.T) {
 	}
 
 	app := NewHTTPApplication("Blueprint Test", "/", "0.0.0.0:7654")
-	app.RegisterBlueprint(NewTestBlueprint())
+	if _, err := app.RegisterBlueprint(NewTestBlueprint()); err != nil {
+		t.Fatalf("Unexpected error registering blueprint: %s", err)
+	}
 
 	var response *httptest.ResponseRecorder
 
@@ -49,3 +54,130 @@ func TestBlueprint(t *testing.T) {
 		t.Errorf("Unexpected value for 'filepath'...\nExpected: '%s'\nActual: '%s'", expected, filepath)
 	}
 }
+
+func TestBlueprintHost(t *testing.T) {
+	var tenant string
+	NewTestHandler := func(response string) func() *Handler {
+		return func() *Handler {
+			handler := NewHandler("/status", HTTP_GET)
+			handler.RequestHandler = func(context *RequestContext) {
+				tenant = context.RequestVars["tenant"]
+				context.Writer.Write([]byte(response))
+			}
+			return handler
+		}
+	}
+	NewConsoleBlueprint := func() *Blueprint {
+		blueprint := NewBlueprint("/")
+		blueprint.Host = "<tenant:string>.console.example.com"
+		blueprint.Register(NewTestHandler("console"))
+		return blueprint
+	}
+	NewAPIBlueprint := func() *Blueprint {
+		blueprint := NewBlueprint("/")
+		blueprint.Host = "api.example.com"
+		blueprint.Register(NewTestHandler("api"))
+		return blueprint
+	}
+
+	app := NewHTTPApplication("Host Test", "/", "0.0.0.0:7654")
+	if _, err := app.RegisterBlueprint(NewConsoleBlueprint()); err != nil {
+		t.Fatalf("Unexpected error registering blueprint: %s", err)
+	}
+	if _, err := app.RegisterBlueprint(NewAPIBlueprint()); err != nil {
+		t.Fatalf("Unexpected error registering blueprint: %s", err)
+	}
+
+	hostTest := func(t *testing.T, host string, expected_code int, expected_body string) {
+		request := createTestRequest("/status")
+		request.Host = host
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		if response.Code != expected_code || response.Body.String() != expected_body {
+			t.Errorf("Unexpected response for host '%s'...\nExpected: %d '%s'\nActual: %d '%s'",
+				host, expected_code, expected_body, response.Code, response.Body.String())
+		}
+	}
+
+	hostTest(t, "api.example.com", 200, "api")
+	hostTest(t, "acme.console.example.com", 200, "console")
+	if tenant != "acme" {
+		t.Errorf("Unexpected value for 'tenant'...\nExpected: 'acme'\nActual: '%s'", tenant)
+	}
+	hostTest(t, "www.example.com", 404, "404 page not found\n")
+}
+
+func TestNestedBlueprint(t *testing.T) {
+	var middleware_order []string
+	NewTestMiddleware := func(name string) Middleware {
+		return func(handler RequestHandler, context *RequestContext) {
+			middleware_order = append(middleware_order, name)
+			handler(context)
+		}
+	}
+
+	admin := NewBlueprint("/admin")
+	admin.Name = "admin"
+	admin.AddMiddleware(NewTestMiddleware("admin"))
+	admin.Templates = template.Must(template.New("page").Parse("admin {{.Data}}"))
+	admin.SetErrorHandler(http.StatusForbidden, func(context *RequestContext, status int) {
+		context.Writer.WriteHeader(status)
+		context.Writer.Write([]byte("admin forbidden"))
+	})
+
+	users := NewBlueprint("/users")
+	users.Name = "users"
+	users.AddMiddleware(NewTestMiddleware("users"))
+
+	permissions := NewBlueprint("/<userid:int>/permissions")
+	permissions.Name = "permissions"
+	permissions.AddMiddleware(NewTestMiddleware("permissions"))
+	permissions.Templates = template.Must(template.New("page").Parse("permissions {{.Data}}"))
+
+	list := NewHandler("/", HTTP_GET)
+	list.Name = "list"
+	list.AddMiddleware(NewTestMiddleware("handler"))
+	list.RequestHandler = func(context *RequestContext) {
+		context.Render("page", context.RequestVars["userid"])
+	}
+	denied := NewHandler("/denied", HTTP_GET)
+	denied.RequestHandler = func(context *RequestContext) {
+		context.Error(http.StatusForbidden)
+	}
+	index := NewHandler("/", HTTP_GET)
+	index.RequestHandler = func(context *RequestContext) {
+		context.Render("page", "index")
+	}
+
+	permissions.RegisterHandler(list)
+	permissions.RegisterHandler(denied)
+	users.RegisterHandler(index)
+	users.RegisterBlueprint(permissions)
+	admin.RegisterBlueprint(users)
+
+	app := NewHTTPApplication("Nested Blueprint Test", "/console", "0.0.0.0:7654")
+	app.AddMiddleware(NewTestMiddleware("app"))
+	if _, err := app.RegisterBlueprint(admin); err != nil {
+		t.Fatalf("Unexpected error registering blueprint: %s", err)
+	}
+
+	nestedTest := func(t *testing.T, request_path string, expected_code int, expected_body string) {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, createTestRequest(request_path))
+		if response.Code != expected_code || response.Body.String() != expected_body {
+			t.Errorf("Unexpected response for '%s'...\nExpected: %d '%s'\nActual: %d '%s'", request_path, expected_code, expected_body, response.Code, response.Body.String())
+		}
+	}
+
+	middleware_order = nil
+	nestedTest(t, "/console/admin/users/17/permissions", 200, "permissions 17")
+	if expected := "app,admin,users,permissions,handler"; strings.Join(middleware_order, ",") != expected {
+		t.Errorf("Unexpected middleware order...\nExpected: '%s'\nActual: '%s'", expected, strings.Join(middleware_order, ","))
+	}
+	nestedTest(t, "/console/admin/users", 200, "admin index")
+	nestedTest(t, "/console/admin/users/17/permissions/denied", 403, "admin forbidden")
+
+	if url, err := app.URLFor("admin.users.permissions.list", map[string]string{"userid": "17"}, nil); err != nil || url != "/console/admin/users/17/permissions" {
+		t.Errorf("Unexpected URL for nested handler '%s': %v", url, err)
+	}
+}
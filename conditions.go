@@ -0,0 +1,154 @@
+package mcgoweb
+
+import (
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Condition is a predicate a request must satisfy, in addition to
+// its path and method, for a handler to be chosen.
+type Condition func(*RequestContext) bool
+
+// HeaderCondition returns a condition requiring the request header.
+// An empty pattern only requires the header to be present,
+// otherwise a value must match the regular expression completely.
+func HeaderCondition(name, pattern string) Condition {
+	value_re := compileConditionPattern(pattern)
+	return func(context *RequestContext) bool {
+		return matchesValues(context.Request.Header.Values(name), value_re)
+	}
+}
+
+// QueryCondition returns a condition requiring the query parameter,
+// matching its value as with HeaderCondition.
+func QueryCondition(name, pattern string) Condition {
+	value_re := compileConditionPattern(pattern)
+	return func(context *RequestContext) bool {
+		return matchesValues(context.Request.URL.Query()[name], value_re)
+	}
+}
+
+func compileConditionPattern(pattern string) *regexp.Regexp {
+	if pattern == "" {
+		return nil
+	}
+	return regexp.MustCompile("^(?:" + pattern + ")$")
+}
+
+func matchesValues(values []string, value_re *regexp.Regexp) bool {
+	if value_re == nil {
+		return len(values) > 0
+	}
+	for _, value := range values {
+		if value_re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkConditions returns http.StatusOK if the request satisfies
+// the route's conditions and media types, otherwise the status to
+// respond with if no other route fits, along with the quality of
+// the best media type produced for the request's Accept header.
+func (route *Route) checkConditions(context *RequestContext) (int, float64) {
+	for _, condition := range route.conditions {
+		if !condition(context) {
+			return http.StatusNotFound, 0
+		}
+	}
+	if len(route.consumes) > 0 {
+		media_type, _, err := mime.ParseMediaType(context.Request.Header.Get("Content-Type"))
+		if err != nil || !matchesMediaRanges(route.consumes, media_type) {
+			return http.StatusUnsupportedMediaType, 0
+		}
+	}
+	if len(route.produces) == 0 {
+		return http.StatusOK, 1
+	}
+	accept := context.Request.Header.Values("Accept")
+	if len(accept) == 0 {
+		return http.StatusOK, 1
+	}
+	ranges := parseAccept(accept)
+	quality := 0.0
+	for _, media_type := range route.produces {
+		if q := acceptQuality(ranges, media_type); q > quality {
+			quality = q
+		}
+	}
+	if quality == 0 {
+		return http.StatusNotAcceptable, 0
+	}
+	return http.StatusOK, quality
+}
+
+// matchesMediaRanges returns whether the media type matches one of
+// the ranges, such as "application/json", "text/*" or "*/*".
+func matchesMediaRanges(ranges []string, media_type string) bool {
+	for _, media_range := range ranges {
+		if mediaRangeSpecificity(media_range, media_type) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// mediaRangeSpecificity returns how specifically the range matches
+// the media type, or -1 if it does not match.
+func mediaRangeSpecificity(media_range, media_type string) int {
+	media_range, media_type = strings.ToLower(media_range), strings.ToLower(media_type)
+	switch {
+	case media_range == "*/*":
+		return 0
+	case strings.HasSuffix(media_range, "/*"):
+		if strings.HasPrefix(media_type, strings.TrimSuffix(media_range, "*")) {
+			return 1
+		}
+	case media_range == media_type:
+		return 2
+	}
+	return -1
+}
+
+type acceptRange struct {
+	media_range string
+	quality     float64
+}
+
+// parseAccept parses Accept header values, ordering the ranges by
+// specificity so the first match for a media type determines its
+// quality.
+func parseAccept(values []string) []acceptRange {
+	var ranges []acceptRange
+	for _, item := range splitHeaderList(values) {
+		media_range, params, err := mime.ParseMediaType(item)
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(q, 64); err == nil {
+				quality = parsed
+			}
+		}
+		ranges = append(ranges, acceptRange{media_range: media_range, quality: quality})
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return strings.Count(ranges[i].media_range, "*") < strings.Count(ranges[j].media_range, "*")
+	})
+	return ranges
+}
+
+func acceptQuality(ranges []acceptRange, media_type string) float64 {
+	for _, accepted := range ranges {
+		if mediaRangeSpecificity(accepted.media_range, media_type) >= 0 {
+			return accepted.quality
+		}
+	}
+	return 0
+}
@@ -0,0 +1,63 @@
+package mcgoweb
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandlerConditions(t *testing.T) {
+	var matched string
+	NewTestHandler := func(name string, methods HTTPMethods) *Handler {
+		handler := NewHandler("/items", methods)
+		handler.RequestHandler = func(context *RequestContext) {
+			matched = name
+		}
+		return handler
+	}
+
+	json_post := NewTestHandler("json", HTTP_POST)
+	json_post.Consumes = []string{"application/json"}
+	form_post := NewTestHandler("form", HTTP_POST)
+	form_post.Consumes = []string{"application/x-www-form-urlencoded", "multipart/*"}
+	html_get := NewTestHandler("html", HTTP_GET)
+	html_get.Produces = []string{"text/html"}
+	json_get := NewTestHandler("json", HTTP_GET)
+	json_get.Produces = []string{"application/json"}
+	beta_get := NewTestHandler("beta", HTTP_GET)
+	beta_get.AddCondition(HeaderCondition("X-Beta", ""))
+	beta_get.AddCondition(QueryCondition("version", "2|3"))
+
+	app := NewHTTPApplication("Conditions Test", "/", "0.0.0.0:7654")
+	for _, handler := range []*Handler{json_post, form_post, html_get, json_get, beta_get} {
+		if _, err := app.RegisterHandler(handler); err != nil {
+			t.Fatalf("Unexpected error registering handler: %s", err)
+		}
+	}
+
+	conditionTest := func(t *testing.T, method, request_path string, header map[string]string, expected_code int, expected string) {
+		matched = ""
+		request := createTestRequest(request_path)
+		request.Method = method
+		request.Header = make(map[string][]string)
+		for name, value := range header {
+			request.Header.Set(name, value)
+		}
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		if response.Code != expected_code || matched != expected {
+			t.Errorf("Condition failure for %s %s %v...\nExpected: %d '%s'\nActual:   %d '%s'", method, request_path, header, expected_code, expected, response.Code, matched)
+		}
+	}
+	conditionTest(t, "POST", "/items", map[string]string{"Content-Type": "application/json; charset=utf-8"}, 200, "json")
+	conditionTest(t, "POST", "/items", map[string]string{"Content-Type": "multipart/form-data; boundary=x"}, 200, "form")
+	conditionTest(t, "POST", "/items", map[string]string{"Content-Type": "text/plain"}, 415, "")
+	conditionTest(t, "POST", "/items", nil, 415, "")
+	conditionTest(t, "GET", "/items", map[string]string{"Accept": "application/json"}, 200, "json")
+	conditionTest(t, "GET", "/items", map[string]string{"Accept": "text/*;q=0.5, application/json;q=0.4"}, 200, "html")
+	conditionTest(t, "GET", "/items", map[string]string{"Accept": "*/*;q=0.1, application/json"}, 200, "json")
+	conditionTest(t, "GET", "/items", map[string]string{"Accept": "image/png"}, 406, "")
+	conditionTest(t, "GET", "/items", map[string]string{"Accept": "application/json;q=0, text/html;q=0"}, 406, "")
+	conditionTest(t, "GET", "/items?version=2", map[string]string{"X-Beta": "1", "Accept": "image/png"}, 200, "beta")
+	conditionTest(t, "GET", "/items?version=4", map[string]string{"X-Beta": "1", "Accept": "image/png"}, 406, "")
+	conditionTest(t, "GET", "/other", nil, 404, "")
+}
@@ -1,6 +1,7 @@
 package mcgoweb
 
 import (
+	stdcontext "context"
 	"net"
 	"net/http"
 	"time"
@@ -10,34 +11,127 @@ import (
 // a request handler is executed.  The context
 // provides all necessary access to request
 // variables as well as constructing the response.
+// The Writer records the response, see Response.
 type RequestContext struct {
 	Request  *http.Request
 	Writer   http.ResponseWriter
 	RequestVars map[string]string
 	Session *Session
+	CSPNonce string
 	
 	sessionCache SessionCache
+	loginTracker *LoginAttemptTracker
+	trustedProxies []*net.IPNet
+	forwarded *forwardedRequest
+	application *HTTPApplication
+	route *Route
+	routingPath string
+	response *ResponseWriter
+	afterRequest *afterRequest
+	span *Span
+	requestID string
+	values *requestValues
+}
+
+// isolate returns a copy of the context which shares no mutable
+// state with it, for a handler which may outlive the request.
+func (context *RequestContext) isolate() *RequestContext {
+	isolated := *context
+	if context.RequestVars != nil {
+		isolated.RequestVars = make(map[string]string, len(context.RequestVars))
+		for name, value := range context.RequestVars {
+			isolated.RequestVars[name] = value
+		}
+	}
+	isolated.Session = context.Session.clone()
+	isolated.values = context.values.clone()
+	isolated.afterRequest = new(afterRequest)
+	return &isolated
+}
+
+// merge passes the state changed by a handler running with an
+// isolated context back to the context.
+func (context *RequestContext) merge(isolated *RequestContext) {
+	context.RequestVars = isolated.RequestVars
+	context.Session = isolated.Session
+	context.CSPNonce = isolated.CSPNonce
+	context.requestID = isolated.requestID
+	context.values = isolated.values
+	isolated.afterRequest.lock.Lock()
+	callbacks := isolated.afterRequest.callbacks
+	isolated.afterRequest.lock.Unlock()
+	for _, callback := range callbacks {
+		context.AfterRequest(callback)
+	}
+}
+
+// Context returns the context of the request, which is canceled
+// when the client disconnects and carries any deadline set for the
+// handler.  The request context is reachable from it with
+// RequestContextFromContext.
+func (context *RequestContext) Context() stdcontext.Context {
+	return context.Request.Context()
+}
+
+// SetContext replaces the context of the request.  The context
+// should be derived from the request's Context so cancellation and
+// request-scoped values are kept.
+func (context *RequestContext) SetContext(ctx stdcontext.Context) {
+	context.Request = context.Request.WithContext(ctx)
 }
 
 // StartSession creates a new session in the current context.
+// Starting a session counts as a successful login for the user
+// when the application has a LoginAttemptTracker.
 func (context *RequestContext) StartSession(user string) {
 	if context.Session != nil {
 		context.Session.Expire()
 	}
 	context.Session = NewUserSession(user, context.sessionCache)
 	context.Session.Store()
+	if context.loginTracker != nil && user != "" {
+		context.loginTracker.Success(user, context.ClientIP())
+	}
 	
 	cookie := &http.Cookie{}
 	cookie.Name = "SID"
 	cookie.Value = context.Session.GetSessionKey()
 	cookie.Expires = context.Session.expiration
 	cookie.Path = "/"
-	host, _, _ := net.SplitHostPort(context.Request.Host)
+	host, _, _ := net.SplitHostPort(context.Host())
 	cookie.Domain = host
 	context.Request.AddCookie(cookie)
 	http.SetCookie(context.Writer,cookie)
 }
 
+// Error responds with the status using the error handler set for
+// it on the innermost blueprint of the current route, its parent
+// blueprints, or the application, in that order.  Without an error
+// handler the status text is written.
+func (context *RequestContext) Error(status int) {
+	var blueprint *Blueprint
+	if context.route != nil {
+		blueprint = context.route.blueprint
+	}
+	for ; blueprint != nil; blueprint = blueprint.parent {
+		if handler, ok := blueprint.ErrorHandlers[status]; ok {
+			handler(context, status)
+			return
+		}
+	}
+	if context.application != nil {
+		if handler, ok := context.application.errorHandlers[status]; ok {
+			handler(context, status)
+			return
+		}
+	}
+	if status == http.StatusNotFound {
+		http.NotFound(context.Writer, context.Request)
+		return
+	}
+	http.Error(context.Writer, http.StatusText(status), status)
+}
+
 // EndSession expires a user's session.
 func (context *RequestContext) EndSession() {
 	if context.Session != nil {
@@ -47,7 +141,7 @@ func (context *RequestContext) EndSession() {
 		cookie.Value = ""
 		cookie.Expires = time.Unix(0,0)
 		cookie.Path = "/"
-		host, _, _ := net.SplitHostPort(context.Request.Host)
+		host, _, _ := net.SplitHostPort(context.Host())
 		cookie.Domain = host
 		context.Request.AddCookie(cookie)
 		http.SetCookie(context.Writer,cookie)
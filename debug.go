@@ -0,0 +1,103 @@
+package mcgoweb
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+)
+
+var debugTemplates = template.Must(template.New("debug").Parse(`{{define "routes"}}<!DOCTYPE html>
+<html><head><title>Routes</title></head><body>
+<h1>Routes</h1>
+<form action="{{.Data.ExplainPath}}" method="get">
+<input name="method" value="GET" size="7"> <input name="url" placeholder="/path?query" size="60"> <button>Explain</button>
+</form>
+<table border="1" cellpadding="4">
+<tr><th>Name</th><th>Methods</th><th>Host</th><th>Path</th><th>Blueprint</th><th>Handler</th><th>Middleware</th></tr>
+{{range .Data.Routes}}<tr><td>{{.Name}}</td><td>{{range .Methods}}{{.}} {{end}}</td><td>{{.Host}}</td><td>{{.Path}}</td><td>{{.Blueprint}}</td><td>{{.Handler}}</td><td>{{range .Middleware}}{{.}}<br>{{end}}</td></tr>
+{{end}}</table>
+</body></html>
+{{end}}{{define "explain"}}<!DOCTYPE html>
+<html><head><title>Explain {{.Data.Method}} {{.Data.URL}}</title></head><body>
+<h1>{{.Data.Method}} {{.Data.URL}}</h1>
+<p>Path {{.Data.Path}}, status {{.Data.Status}}{{with .Data.Location}}, redirected to {{.}}{{end}}{{with .Data.Route}}, handled by {{.Path}}{{end}}</p>
+<table border="1" cellpadding="4">
+<tr><th>Methods</th><th>Host</th><th>Path</th><th>Reason</th></tr>
+{{range .Data.Candidates}}<tr><td>{{range .Methods}}{{.}} {{end}}</td><td>{{.Host}}</td><td>{{if .Chosen}}<b>{{.Path}}</b>{{else}}{{.Path}}{{end}}</td><td>{{.Reason}}</td></tr>
+{{end}}</table>
+</body></html>
+{{end}}`))
+
+type debugRoutesPage struct {
+	Routes      []RouteInfo
+	ExplainPath string
+}
+
+// NewDebugBlueprint returns a blueprint at the given path listing
+// the application's routes at "/routes" and explaining how a request
+// would be routed at "/explain".  The explained request is given by
+// the method, url, accept and content_type query parameters.  Both
+// respond with JSON or HTML depending on the Accept header.  The
+// blueprint exposes the application's structure, so middleware
+// restricting access should be added before it is registered.
+func NewDebugBlueprint(path string, app *HTTPApplication) *Blueprint {
+	blueprint := NewBlueprint(path)
+	blueprint.Name = "debug"
+
+	routes_json := func(context *RequestContext) interface{} {
+		return app.Routes()
+	}
+	routes_page := func(context *RequestContext) interface{} {
+		explain_path, _ := context.URLFor(".explain", nil, nil)
+		return &debugRoutesPage{Routes: app.Routes(), ExplainPath: explain_path}
+	}
+	explain_page := func(context *RequestContext) interface{} {
+		query := context.Request.URL.Query()
+		method := query.Get("method")
+		if method == "" {
+			method = "GET"
+		}
+		target, err := url.Parse(query.Get("url"))
+		if err != nil {
+			target = &url.URL{Path: "/"}
+		}
+		request := &http.Request{Method: method, URL: target, Host: target.Host, Header: make(http.Header)}
+		if request.Host == "" {
+			request.Host = context.Request.Host
+		}
+		if accept := query.Get("accept"); accept != "" {
+			request.Header.Set("Accept", accept)
+		}
+		if content_type := query.Get("content_type"); content_type != "" {
+			request.Header.Set("Content-Type", content_type)
+		}
+		return app.Explain(request)
+	}
+
+	addDebugPage(blueprint, "routes", routes_json, routes_page)
+	addDebugPage(blueprint, "explain", explain_page, explain_page)
+	return blueprint
+}
+
+// addDebugPage registers handlers for the page responding with JSON,
+// preferred when either is acceptable, or with the HTML template.
+func addDebugPage(blueprint *Blueprint, name string, json_data, html_data func(*RequestContext) interface{}) {
+	json_handler := NewHandler("/"+name, HTTP_GET)
+	json_handler.Name = name + "_json"
+	json_handler.Produces = []string{"application/json"}
+	json_handler.RequestHandler = func(context *RequestContext) {
+		context.Writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(context.Writer).Encode(json_data(context))
+	}
+	html_handler := NewHandler("/"+name, HTTP_GET)
+	html_handler.Name = name
+	html_handler.Produces = []string{"text/html"}
+	html_handler.RequestHandler = func(context *RequestContext) {
+		if err := context.RenderTemplate(debugTemplates, name, html_data(context)); err != nil {
+			context.Error(http.StatusInternalServerError)
+		}
+	}
+	blueprint.RegisterHandler(json_handler)
+	blueprint.RegisterHandler(html_handler)
+}
@@ -0,0 +1,82 @@
+package mcgoweb
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRoutes(t *testing.T) {
+	app := NewHTTPApplication("Routes Test", "/", "0.0.0.0:7654")
+	app.AddMiddleware(SessionMiddleware)
+	users := NewBlueprint("/users")
+	users.Name = "users"
+	show := NewHandler("/<userid:int>", HTTP_GET|HTTP_PUT)
+	show.Name = "show"
+	show.RequestHandler = func(context *RequestContext) {}
+	create := NewHandler("/", HTTP_POST)
+	create.Consumes = []string{"application/json"}
+	create.RequestHandler = func(context *RequestContext) {}
+	users.RegisterHandler(show)
+	users.RegisterHandler(create)
+	if _, err := app.RegisterBlueprint(users); err != nil {
+		t.Fatalf("Unexpected error registering blueprint: %s", err)
+	}
+	if _, err := app.RegisterBlueprint(NewDebugBlueprint("/_debug", app)); err != nil {
+		t.Fatalf("Unexpected error registering blueprint: %s", err)
+	}
+
+	routes := app.Routes()
+	if len(routes) != 6 {
+		t.Fatalf("Unexpected number of routes %d, expected 6", len(routes))
+	}
+	var found bool
+	for _, route := range routes {
+		if route.Name == "users.show" {
+			found = true
+			if route.Path != "/users/<userid:int>" || strings.Join(route.Methods, ",") != "GET,PUT" || route.Blueprint != "users" {
+				t.Errorf("Unexpected route info %+v", route)
+			}
+			if len(route.Middleware) != 1 || !strings.HasSuffix(route.Middleware[0], "SessionMiddleware") {
+				t.Errorf("Unexpected middleware %v", route.Middleware)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Named route missing from %+v", routes)
+	}
+
+	explanation := app.Explain(createTestRequest("/users/17"))
+	if explanation.Route == nil || explanation.Route.Name != "users.show" || explanation.Status != 200 {
+		t.Fatalf("Unexpected explanation %+v", explanation)
+	}
+	for _, candidate := range explanation.Candidates {
+		if candidate.Path == "/users" && !strings.Contains(candidate.Reason, "method GET") {
+			t.Errorf("Unexpected reason for '%s': '%s'", candidate.Path, candidate.Reason)
+		}
+	}
+	post := createTestRequest("/users")
+	post.Method = "POST"
+	post.Header = map[string][]string{"Content-Type": {"text/plain"}}
+	if explanation := app.Explain(post); explanation.Route != nil || explanation.Status != 415 {
+		t.Errorf("Unexpected explanation %+v", explanation)
+	}
+
+	request := createTestRequest("/_debug/routes")
+	request.Header = map[string][]string{"Accept": {"application/json"}}
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, request)
+	var listed []RouteInfo
+	if err := json.Unmarshal(response.Body.Bytes(), &listed); err != nil || len(listed) != 6 {
+		t.Errorf("Unexpected JSON route table %d %s: %v", response.Code, response.Body.String(), err)
+	}
+
+	request = createTestRequest("/_debug/explain?url=/users/abc")
+	request.Header = map[string][]string{"Accept": {"text/html"}}
+	response = httptest.NewRecorder()
+	app.ServeHTTP(response, request)
+	if body := response.Body.String(); response.Code != 200 || !strings.Contains(body, "status 404") || !strings.Contains(body, "/users/abc does not match") {
+		t.Errorf("Unexpected HTML explanation %d %s", response.Code, body)
+	}
+}
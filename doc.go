@@ -32,7 +32,9 @@ Example using middleware and a handler generator
 	
 	func main() {
 		app := mcgoweb.NewHTTPApplication("Sample App", "/", "0.0.0.0:7070")
-		app.Register(TestHandler)
+		if _, err := app.Register(TestHandler); err != nil {
+			log.Fatal(err)
+		}
 		app.Run()
 	}
 
@@ -1,6 +1,8 @@
 package mcgoweb
 
-import ()
+import (
+	"time"
+)
 
 // RequestHandler is a function definition for an implementation
 // of an HTTP request.
@@ -8,14 +10,41 @@ type RequestHandler func(*RequestContext)
 
 // Middleware is a function that wraps a request handler to
 // allow calling code before and after an HTTP request handler.
+// Middleware is only called for requests matching a route, so
+// requests the router answers with 404, 406 or 415, and redirected
+// requests, never reach it.
 type Middleware func(RequestHandler, *RequestContext)
 
 // Handler represents the handling process for an HTTP request.
+// The Path may contain variables such as "<userid:int>",
+// "<id:re:[a-f0-9]{8}>" or "file-<n:int>.json", and optional
+// trailing segments such as "/archive/<year:int>[/<month:int>]".
+// A named handler's path can be built with URLFor.  A Host
+// pattern, such as "<tenant:string>.example.com", restricts the
+// handler to matching hosts and overrides the blueprint's Host.
+// A non-zero MaxBodyBytes, Timeout or Deadline overrides the limit
+// set on the handler's blueprint.
+//
+// Conditions, Consumes and Produces let several handlers share a
+// path.  Consumes lists the media ranges accepted as the request's
+// Content-Type and Produces the media types the handler can respond
+// with, negotiated against the request's Accept header.  When no
+// handler fits a request, 415 or 406 is returned.
 type Handler struct {
 	RequestHandler
 	Middleware []Middleware
+	Name       string
 	Path       string
+	Host       string
 	HTTPMethods
+	MaxBodyBytes int64
+	Timeout      time.Duration
+	Deadline     time.Duration
+	Conditions   []Condition
+	Consumes     []string
+	Produces     []string
+
+	mount bool
 }
 
 // HandlerGenerator is a function definition which returns a
@@ -31,6 +60,12 @@ func NewHandler(path string, methods HTTPMethods) *Handler {
 	return handler
 }
 
+// AddCondition adds a condition the request must satisfy for the
+// handler to be chosen.
+func (handler *Handler) AddCondition(condition Condition) {
+	handler.Conditions = append(handler.Conditions, condition)
+}
+
 // AddMiddleware adds a middleware function to the handler to
 // be called after previously added handler middleware.  Any
 // Middleware added to an application or blueprint will always
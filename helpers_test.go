@@ -17,7 +17,8 @@ func createTestRequest(request_path string) *http.Request {
 // Helper to create a route and context
 func createTestRouteAndContext(request_path, route_path string) (*Route, *RequestContext) {
 	route := new(Route)
-	route.pathRE = regexp.MustCompile(getPathPattern(route_path))
+	route_pattern, _ := getPathPattern(route_path)
+	route.pathRE = regexp.MustCompile(route_pattern)
 	route.Path = route_path
 	route.Methods = HTTP_GET
 
@@ -0,0 +1,130 @@
+package mcgoweb
+
+import (
+	stdcontext "context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type requestContextKey struct{}
+
+// RequestContextFromRequest returns the RequestContext of a request
+// being served by an application, allowing net/http handlers and
+// middleware to reach the session and request variables.
+func RequestContextFromRequest(request *http.Request) *RequestContext {
+	return RequestContextFromContext(request.Context())
+}
+
+// RequestContextFromContext returns the RequestContext of the
+// request a context was derived from, or nil.
+func RequestContextFromContext(ctx stdcontext.Context) *RequestContext {
+	context, _ := ctx.Value(requestContextKey{}).(*RequestContext)
+	return context
+}
+
+func withRequestContext(request *http.Request, context *RequestContext) *http.Request {
+	return request.WithContext(stdcontext.WithValue(request.Context(), requestContextKey{}, context))
+}
+
+// FromHTTPHandler returns a request handler serving requests with
+// the http.Handler.
+func FromHTTPHandler(handler http.Handler) RequestHandler {
+	return func(context *RequestContext) {
+		handler.ServeHTTP(context.Writer, context.Request)
+	}
+}
+
+// NewMountHandler returns a handler serving every request for the
+// prefix and any path below it with the http.Handler, for any HTTP
+// method.  The full matched prefix, including any application root
+// and blueprint path, is stripped from the request's path.
+func NewMountHandler(prefix string, handler http.Handler) *Handler {
+	mount_handler := NewHandler(prefix, HTTP_ANY)
+	mount_handler.mount = true
+	mount_handler.RequestHandler = func(context *RequestContext) {
+		request := context.Request
+		if context.route != nil && context.route.mountRE != nil {
+			prefix := context.route.mountRE.FindString(canonicalPath(request.URL))
+			if decoded, err := url.PathUnescape(prefix); err == nil {
+				request = stripMountPrefix(request, decoded)
+			}
+		}
+		handler.ServeHTTP(context.Writer, request)
+	}
+	return mount_handler
+}
+
+// stripMountPrefix returns a copy of the request with the prefix
+// removed from its path, keeping the original escaping when the
+// raw path starts with the escaped prefix.
+func stripMountPrefix(request *http.Request, prefix string) *http.Request {
+	stripped := new(http.Request)
+	*stripped = *request
+	stripped.URL = new(url.URL)
+	*stripped.URL = *request.URL
+
+	stripped.URL.Path = strings.TrimPrefix(request.URL.Path, prefix)
+	if !strings.HasPrefix(stripped.URL.Path, "/") {
+		stripped.URL.Path = "/" + stripped.URL.Path
+	}
+	stripped.URL.RawPath = ""
+	if raw_path := request.URL.RawPath; raw_path != "" {
+		if escaped_prefix := escapePath(prefix); strings.HasPrefix(raw_path, escaped_prefix) {
+			raw_path = strings.TrimPrefix(raw_path, escaped_prefix)
+			if !strings.HasPrefix(raw_path, "/") {
+				raw_path = "/" + raw_path
+			}
+			stripped.URL.RawPath = raw_path
+		}
+	}
+	return stripped
+}
+
+// FromHTTPMiddleware adapts standard net/http middleware into a
+// Middleware.  The request passed through the standard middleware
+// carries the RequestContext, and any request or writer the
+// middleware replaces is used by the following handlers.  The
+// original request and writer are restored once the middleware
+// returns.
+func FromHTTPMiddleware(middleware func(http.Handler) http.Handler) Middleware {
+	return func(handler RequestHandler, context *RequestContext) {
+		writer, original := context.Writer, context.Request
+		defer func() {
+			context.Writer, context.Request = writer, original
+		}()
+		next := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			context.Writer = writer
+			context.Request = request
+			handler(context)
+		})
+		request := context.Request
+		if RequestContextFromRequest(request) != context {
+			request = withRequestContext(request, context)
+		}
+		middleware(next).ServeHTTP(context.Writer, request)
+	}
+}
+
+// ToHTTPMiddleware adapts a Middleware into standard net/http
+// middleware.  Requests served by an application reuse their
+// RequestContext, other requests are given a new one.
+func ToHTTPMiddleware(middleware Middleware) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			context := RequestContextFromRequest(request)
+			if context == nil {
+				context = new(RequestContext)
+				context.response = NewResponseWriter(writer)
+				writer = context.response
+				request = withRequestContext(request, context)
+				defer context.runAfterRequest()
+			}
+			context.Writer = writer
+			context.Request = request
+			middleware(func(context *RequestContext) {
+				next.ServeHTTP(context.Writer, context.Request)
+			}, context)
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package mcgoweb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMount(t *testing.T) {
+	var mounted_path, mounted_raw_path string
+	mounted := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mounted_path, mounted_raw_path = request.URL.Path, request.URL.RawPath
+	})
+
+	app := NewHTTPApplication("Mount Test", "/somewebapp", "0.0.0.0:7654")
+	if _, err := app.Mount("/static", mounted); err != nil {
+		t.Fatalf("Unexpected error mounting handler: %s", err)
+	}
+	blueprint := NewBlueprint("/admin")
+	blueprint.Mount("/debug/", mounted)
+	if _, err := app.RegisterBlueprint(blueprint); err != nil {
+		t.Fatalf("Unexpected error registering blueprint: %s", err)
+	}
+	handler := NewHandler("/static/index.html", HTTP_GET)
+	handler.RequestHandler = func(context *RequestContext) {
+		mounted_path = "handler"
+	}
+	if _, err := app.RegisterHandler(handler); err != nil {
+		t.Fatalf("Unexpected error registering handler: %s", err)
+	}
+
+	mountTest := func(t *testing.T, method, request_path, expected_path, expected_raw_path string) {
+		mounted_path, mounted_raw_path = "", ""
+		request := createTestRequest(request_path)
+		request.Method = method
+		app.ServeHTTP(httptest.NewRecorder(), request)
+		if mounted_path != expected_path || mounted_raw_path != expected_raw_path {
+			t.Errorf("Mount failure for '%s'...\nExpected: '%s' '%s'\nActual:   '%s' '%s'", request_path, expected_path, expected_raw_path, mounted_path, mounted_raw_path)
+		}
+	}
+	mountTest(t, "GET", "/somewebapp/static", "/", "")
+	mountTest(t, "GET", "/somewebapp/static/", "/", "")
+	mountTest(t, "HEAD", "/somewebapp/static/css/site.css", "/css/site.css", "")
+	mountTest(t, "GET", "/somewebapp/static/a%2Fb", "/a/b", "/a%2Fb")
+	mountTest(t, "GET", "/somewebapp/static/index.html", "handler", "")
+	mountTest(t, "PATCH", "/somewebapp/admin/debug/vars", "/vars", "")
+	mountTest(t, "GET", "/somewebapp/staticfiles", "", "")
+}
+
+func TestHTTPMiddlewareAdapters(t *testing.T) {
+	standard := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if context := RequestContextFromRequest(request); context != nil {
+				writer.Header().Set("X-Userid", context.RequestVars["userid"])
+			}
+			next.ServeHTTP(struct{ http.ResponseWriter }{writer}, request)
+		})
+	}
+
+	var from_request *RequestContext
+	handler := NewHandler("/user/<userid:int>", HTTP_GET)
+	handler.AddMiddleware(func(handler RequestHandler, context *RequestContext) {
+		writer, request := context.Writer, context.Request
+		handler(context)
+		if context.Writer != writer || context.Request != request {
+			t.Errorf("Writer and request replaced by standard middleware not restored")
+		}
+	})
+	handler.AddMiddleware(FromHTTPMiddleware(standard))
+	handler.RequestHandler = func(context *RequestContext) {
+		from_request = RequestContextFromRequest(context.Request)
+		if from_request != context {
+			t.Errorf("Request context not available from the request")
+		}
+	}
+	app := NewHTTPApplication("Adapter Test", "/", "0.0.0.0:7654")
+	if _, err := app.RegisterHandler(handler); err != nil {
+		t.Fatalf("Unexpected error registering handler: %s", err)
+	}
+
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, createTestRequest("/user/17"))
+	if expected := "17"; response.Header().Get("X-Userid") != expected {
+		t.Errorf("Unexpected X-Userid header '%s', expected '%s'", response.Header().Get("X-Userid"), expected)
+	}
+	if from_request == nil {
+		t.Fatalf("Handler not called")
+	}
+
+	var called bool
+	wrapped := ToHTTPMiddleware(func(handler RequestHandler, context *RequestContext) {
+		context.Writer.Header().Set("X-Middleware", "called")
+		handler(context)
+	})(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		called = RequestContextFromRequest(request) != nil
+	}))
+	response = httptest.NewRecorder()
+	wrapped.ServeHTTP(response, createTestRequest("/"))
+	if !called || response.Header().Get("X-Middleware") != "called" {
+		t.Errorf("Adapted middleware failure, called %t, header '%s'", called, response.Header().Get("X-Middleware"))
+	}
+}
@@ -0,0 +1,104 @@
+package mcgoweb
+
+import (
+	stdcontext "context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// MaxBodyBytesMiddleware returns a middleware limiting request
+// bodies to the given number of bytes.  Requests declaring a
+// larger Content-Length are refused with 413 Request Entity Too
+// Large before the handler is called.  Otherwise reading past the
+// limit returns an *http.MaxBytesError to the handler, and if the
+// handler has not responded a 413 is written when it returns.
+func MaxBodyBytesMiddleware(limit int64) Middleware {
+	return func(handler RequestHandler, context *RequestContext) {
+		if context.Request.ContentLength > limit {
+			http.Error(context.Writer, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if context.Request.Body == nil {
+			handler(context)
+			return
+		}
+
+		body := &limitedBody{ReadCloser: http.MaxBytesReader(context.Writer, context.Request.Body, limit)}
+		writer, outer := NewResponseWriter(context.Writer), context.Writer
+		context.Request.Body = body
+		context.Writer = writer
+		handler(context)
+		context.Writer = outer
+
+		if body.exceeded && !writer.Written() {
+			http.Error(context.Writer, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		}
+	}
+}
+
+// TimeoutMiddleware returns a middleware giving the handler the
+// given time to respond, after which the request is answered with
+// 503 Service Unavailable.  The handler runs with an isolated copy
+// of the request context whose request carries the deadline, and
+// should stop work once the request's context is done.  The
+// session, request variables, values and after-request callbacks
+// of the copy are only passed back when the handler returns in
+// time.  Responses are buffered until the handler returns, so
+// streaming and hijacking are not supported.
+func TimeoutMiddleware(timeout time.Duration) Middleware {
+	return func(handler RequestHandler, context *RequestContext) {
+		// The handler may still be running after a timeout, so
+		// it must not share anything mutable with the caller.
+		timed_context := context.isolate()
+		var lock sync.Mutex
+		var completed, abandoned bool
+		http.TimeoutHandler(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			timed_context.response = NewResponseWriter(writer)
+			timed_context.Writer = timed_context.response
+			timed_context.Request = withRequestContext(request.Clone(request.Context()), timed_context)
+			handler(timed_context)
+			lock.Lock()
+			completed = !abandoned
+			lock.Unlock()
+		}), timeout, http.StatusText(http.StatusServiceUnavailable)).ServeHTTP(context.Writer, context.Request)
+
+		lock.Lock()
+		abandoned = !completed
+		lock.Unlock()
+		if completed {
+			context.merge(timed_context)
+		}
+	}
+}
+
+// DeadlineMiddleware returns a middleware setting a deadline the
+// given time away on the request's context.  Unlike a timeout the
+// response is left to the handler, which should stop work and
+// respond once the context is done.
+func DeadlineMiddleware(deadline time.Duration) Middleware {
+	return func(handler RequestHandler, context *RequestContext) {
+		ctx, cancel := stdcontext.WithTimeout(context.Context(), deadline)
+		defer cancel()
+		outer := context.Context()
+		context.SetContext(ctx)
+		handler(context)
+		context.SetContext(outer)
+	}
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	exceeded bool
+}
+
+func (body *limitedBody) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+	var max_bytes_error *http.MaxBytesError
+	if errors.As(err, &max_bytes_error) {
+		body.exceeded = true
+	}
+	return n, err
+}
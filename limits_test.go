@@ -0,0 +1,177 @@
+package mcgoweb
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBodyLimits(t *testing.T) {
+	var body_error error
+	NewTestHandler := func() *Handler {
+		handler := NewHandler("/upload", HTTP_POST)
+		handler.RequestHandler = func(context *RequestContext) {
+			_, body_error = ioutil.ReadAll(context.Request.Body)
+		}
+		return handler
+	}
+	NewSmallHandler := func() *Handler {
+		handler := NewTestHandler()
+		handler.Path = "/small"
+		handler.MaxBodyBytes = 4
+		return handler
+	}
+	NewTestBlueprint := func() *Blueprint {
+		blueprint := NewBlueprint("/api")
+		blueprint.MaxBodyBytes = 16
+		blueprint.Register(NewTestHandler)
+		blueprint.Register(NewSmallHandler)
+		return blueprint
+	}
+
+	app := NewHTTPApplication("Limit Test", "/", "0.0.0.0:7654")
+	if _, err := app.RegisterBlueprint(NewTestBlueprint()); err != nil {
+		t.Fatalf("Unexpected error registering blueprint: %s", err)
+	}
+
+	upload := func(path, body string, content_length int64) *httptest.ResponseRecorder {
+		request := createTestRequest(path)
+		request.Method = "POST"
+		request.Body = ioutil.NopCloser(strings.NewReader(body))
+		request.ContentLength = content_length
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		return response
+	}
+
+	body_error = nil
+	if response := upload("/api/upload", "0123456789", 10); response.Code != 200 || body_error != nil {
+		t.Errorf("Unexpected response code %d (%v), expected 200", response.Code, body_error)
+	}
+	if response := upload("/api/upload", strings.Repeat("x", 32), 32); response.Code != 413 {
+		t.Errorf("Unexpected response code %d for declared length, expected 413", response.Code)
+	}
+	if response := upload("/api/upload", strings.Repeat("x", 32), -1); response.Code != 413 {
+		t.Errorf("Unexpected response code %d for chunked body, expected 413", response.Code)
+	}
+	if body_error == nil {
+		t.Errorf("Handler not given an error reading past the limit")
+	}
+	if response := upload("/api/small", "0123456789", 10); response.Code != 413 {
+		t.Errorf("Unexpected response code %d for handler limit, expected 413", response.Code)
+	}
+}
+
+func TestHandlerTimeout(t *testing.T) {
+	NewTestHandler := func() *Handler {
+		handler := NewHandler("/slow", HTTP_GET)
+		handler.Timeout = 10 * time.Millisecond
+		handler.RequestHandler = func(context *RequestContext) {
+			<-context.Request.Context().Done()
+			context.Writer.WriteHeader(200)
+		}
+		return handler
+	}
+
+	app := NewHTTPApplication("Timeout Test", "/", "0.0.0.0:7654")
+	if _, err := app.Register(NewTestHandler); err != nil {
+		t.Fatalf("Unexpected error registering handler: %s", err)
+	}
+
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, createTestRequest("/slow"))
+	if response.Code != 503 {
+		t.Errorf("Unexpected response code %d, expected 503", response.Code)
+	}
+}
+
+func TestHandlerTimeoutIsolation(t *testing.T) {
+	count_key := NewKey[int]("count")
+	release := make(chan struct{})
+	finished := make(chan struct{})
+	var timed_out bool
+	var count int
+	var user string
+	var callbacks []string
+
+	app := NewHTTPApplication("Timeout Test", "/", "0.0.0.0:7654")
+	app.SetSessionCache(NewMemorySessionCache())
+	app.AddMiddleware(func(handler RequestHandler, context *RequestContext) {
+		context.AfterRequest(func(context *RequestContext) {
+			callbacks = append(callbacks, "outer")
+		})
+		handler(context)
+		count, _ = count_key.Get(context)
+		if context.Session != nil {
+			user, _ = context.Session.GetValue("user")
+		}
+		context.RequestVars["seen"] = "outer"
+	})
+
+	slow := NewHandler("/<mode>", HTTP_GET)
+	slow.Timeout = 50 * time.Millisecond
+	slow.RequestHandler = func(context *RequestContext) {
+		if context.RequestVars["mode"] == "slow" {
+			defer close(finished)
+			<-release
+		}
+		// Runs after the timeout for the slow request, racing with
+		// the outer middleware and after-request callbacks unless
+		// the context is isolated.
+		count_key.Set(context, 1)
+		context.RequestVars["seen"] = "handler"
+		context.AfterRequest(func(context *RequestContext) {
+			callbacks = append(callbacks, "handler")
+		})
+		context.Request.Header = make(map[string][]string)
+		context.StartSession("admin")
+		timed_out = RequestContextFromRequest(context.Request) != context
+	}
+	if _, err := app.RegisterHandler(slow); err != nil {
+		t.Fatalf("Unexpected error registering handler: %s", err)
+	}
+
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, createTestRequest("/slow"))
+	close(release)
+	<-finished
+	if response.Code != 503 {
+		t.Errorf("Unexpected response code %d, expected 503", response.Code)
+	}
+	if count != 0 || user != "" || strings.Join(callbacks, ",") != "outer" {
+		t.Errorf("Timed out handler state leaked: count %d, user %q, callbacks %v", count, user, callbacks)
+	}
+
+	callbacks = nil
+	response = httptest.NewRecorder()
+	app.ServeHTTP(response, createTestRequest("/fast"))
+	if response.Code != 200 {
+		t.Errorf("Unexpected response code %d, expected 200", response.Code)
+	}
+	if count != 1 || user != "admin" || strings.Join(callbacks, ",") != "handler,outer" {
+		t.Errorf("Handler state not passed back: count %d, user %q, callbacks %v", count, user, callbacks)
+	}
+	if timed_out {
+		t.Errorf("Expected handler's request to carry its own request context")
+	}
+}
+
+func TestConfigurationDurations(t *testing.T) {
+	configuration := NewHTTPApplicationConfiguration("", "/", "")
+	err := json.Unmarshal([]byte(`{"Name": "Console", "ReadTimeout": "30s", "WriteTimeout": 1000000000}`), &configuration)
+	if err != nil {
+		t.Fatalf("Unexpected configuration error: %s", err)
+	}
+	if expected := Duration(30 * time.Second); configuration.ReadTimeout != expected {
+		t.Errorf("Unexpected read timeout %s, expected %s", time.Duration(configuration.ReadTimeout), time.Duration(expected))
+	}
+	if expected := Duration(time.Second); configuration.WriteTimeout != expected {
+		t.Errorf("Unexpected write timeout %s, expected %s", time.Duration(configuration.WriteTimeout), time.Duration(expected))
+	}
+	if configuration.ReadHeaderTimeout != DefaultReadHeaderTimeout {
+		t.Errorf("Default read header timeout not kept")
+	}
+}
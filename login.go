@@ -0,0 +1,316 @@
+package mcgoweb
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrInvalidLogin is returned by AttemptLogin when the credentials
+// could not be verified.
+var ErrInvalidLogin = errors.New("mcgoweb: invalid login")
+
+// LoginThrottledError is returned when a login is attempted before
+// the backoff delay or lockout from previous failures has passed.
+type LoginThrottledError struct {
+	User       string
+	RetryAfter time.Duration
+}
+
+func (err *LoginThrottledError) Error() string {
+	return fmt.Sprintf("mcgoweb: login for %q throttled, retry after %s", err.User, err.RetryAfter)
+}
+
+// LoginAttemptEvent represents a lockout reported to a
+// LoginAttemptTracker's Notify hook.
+type LoginAttemptEvent struct {
+	User        string
+	IP          string
+	Failures    int
+	LockedUntil time.Time
+}
+
+// LoginAttemptTracker tracks failed login attempts by username and
+// by source IP.  After FreeAttempts failures each further attempt
+// is delayed by an exponentially increasing backoff, and after
+// LockoutThreshold failures attempts are refused for the
+// LockoutDuration.  Failures are forgotten after ResetAfter
+// without further attempts.
+//
+// Check reserves an attempt until it is recorded with Failure or
+// Success, or returned with Release, so concurrent attempts can not
+// all pass before their failures are recorded.  Reservations not
+// recorded within AttemptTimeout are returned automatically.
+//
+// At most MaxEntries usernames and IPs are tracked, the least
+// recently used being forgotten first, and expired entries are
+// swept every SweepInterval.
+type LoginAttemptTracker struct {
+	FreeAttempts     int
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	ResetAfter       time.Duration
+	AttemptTimeout   time.Duration
+	MaxEntries       int
+	SweepInterval    time.Duration
+	Notify           func(LoginAttemptEvent)
+
+	mutex      sync.Mutex
+	attempts   map[string]*loginAttempts
+	recent     *list.List
+	next_sweep time.Time
+}
+
+type loginAttempts struct {
+	key           string
+	failures      int
+	last_failure  time.Time
+	blocked_until time.Time
+	pending       int
+	pending_since time.Time
+	element       *list.Element
+}
+
+// NewLoginAttemptTracker returns a new LoginAttemptTracker with
+// default backoff and lockout settings.
+func NewLoginAttemptTracker() *LoginAttemptTracker {
+	tracker := new(LoginAttemptTracker)
+	tracker.FreeAttempts = 3
+	tracker.BaseDelay = time.Second
+	tracker.MaxDelay = time.Minute
+	tracker.LockoutThreshold = 10
+	tracker.LockoutDuration = 15 * time.Minute
+	tracker.ResetAfter = time.Hour
+	tracker.AttemptTimeout = 30 * time.Second
+	tracker.MaxEntries = 100000
+	tracker.SweepInterval = time.Minute
+	tracker.attempts = make(map[string]*loginAttempts)
+	return tracker
+}
+
+// Check returns a LoginThrottledError if attempts for the user or
+// from the IP address are currently delayed or locked out.
+// Otherwise an attempt is reserved.  While reserved attempts would
+// take the failures past FreeAttempts, further attempts are
+// throttled until they are recorded.
+func (tracker *LoginAttemptTracker) Check(user, ip string) error {
+	now := time.Now()
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	keys := loginAttemptKeys(user, ip)
+	var retry_after time.Duration
+	for _, key := range keys {
+		if attempts := tracker.get(key, now); attempts != nil {
+			wait := attempts.blocked_until.Sub(now)
+			if attempts.pending > 0 && attempts.failures+attempts.pending >= tracker.FreeAttempts && wait < tracker.BaseDelay {
+				wait = tracker.BaseDelay
+			}
+			if wait > retry_after {
+				retry_after = wait
+			}
+		}
+	}
+	if retry_after > 0 {
+		return &LoginThrottledError{User: user, RetryAfter: retry_after}
+	}
+	for _, key := range keys {
+		attempts := tracker.getOrCreate(key, now)
+		attempts.pending++
+		attempts.pending_since = now
+	}
+	return nil
+}
+
+// Release returns an attempt reserved by Check which was neither
+// failed nor successful, such as a login waiting on a second
+// factor.
+func (tracker *LoginAttemptTracker) Release(user, ip string) {
+	now := time.Now()
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	for _, key := range loginAttemptKeys(user, ip) {
+		if attempts := tracker.get(key, now); attempts != nil && attempts.pending > 0 {
+			attempts.pending--
+		}
+	}
+}
+
+// Failure records a failed login attempt for the user from the
+// IP address.
+func (tracker *LoginAttemptTracker) Failure(user, ip string) {
+	now := time.Now()
+	var events []LoginAttemptEvent
+
+	tracker.mutex.Lock()
+	for _, key := range loginAttemptKeys(user, ip) {
+		attempts := tracker.getOrCreate(key, now)
+		if attempts.pending > 0 {
+			attempts.pending--
+		}
+		attempts.failures++
+		attempts.last_failure = now
+
+		if tracker.LockoutThreshold > 0 && attempts.failures >= tracker.LockoutThreshold {
+			attempts.blocked_until = now.Add(tracker.LockoutDuration)
+			events = append(events, LoginAttemptEvent{
+				User:        user,
+				IP:          ip,
+				Failures:    attempts.failures,
+				LockedUntil: attempts.blocked_until,
+			})
+		} else if attempts.failures > tracker.FreeAttempts {
+			attempts.blocked_until = now.Add(tracker.backoff(attempts.failures - tracker.FreeAttempts))
+		}
+	}
+	tracker.mutex.Unlock()
+
+	if tracker.Notify != nil {
+		for _, event := range events {
+			tracker.Notify(event)
+		}
+	}
+}
+
+// Success records a successful login, clearing previous failures
+// for the user.  Failures from the IP address are kept so a valid
+// account can not be used to reset the limit on guessing others.
+func (tracker *LoginAttemptTracker) Success(user, ip string) {
+	now := time.Now()
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	if attempts := tracker.get("user:"+user, now); attempts != nil {
+		tracker.remove(attempts)
+	}
+	if attempts := tracker.get("ip:"+ip, now); attempts != nil && attempts.pending > 0 {
+		attempts.pending--
+	}
+}
+
+// get returns the attempts for the key, marking them as recently
+// used, or nil if there are none or they have expired.
+func (tracker *LoginAttemptTracker) get(key string, now time.Time) *loginAttempts {
+	tracker.sweep(now)
+	attempts, ok := tracker.attempts[key]
+	if !ok {
+		return nil
+	}
+	if tracker.expired(attempts, now) {
+		tracker.remove(attempts)
+		return nil
+	}
+	tracker.recent.MoveToFront(attempts.element)
+	return attempts
+}
+
+func (tracker *LoginAttemptTracker) getOrCreate(key string, now time.Time) *loginAttempts {
+	if attempts := tracker.get(key, now); attempts != nil {
+		return attempts
+	}
+	if tracker.MaxEntries > 0 {
+		for len(tracker.attempts) >= tracker.MaxEntries {
+			tracker.remove(tracker.recent.Back().Value.(*loginAttempts))
+		}
+	}
+	attempts := &loginAttempts{key: key}
+	attempts.element = tracker.recent.PushFront(attempts)
+	tracker.attempts[key] = attempts
+	return attempts
+}
+
+// expired returns whether the attempts can be forgotten, returning
+// reservations which have timed out.
+func (tracker *LoginAttemptTracker) expired(attempts *loginAttempts, now time.Time) bool {
+	if attempts.pending > 0 && tracker.AttemptTimeout > 0 && now.Sub(attempts.pending_since) > tracker.AttemptTimeout {
+		attempts.pending = 0
+	}
+	if attempts.pending > 0 || now.Before(attempts.blocked_until) {
+		return false
+	}
+	return attempts.failures == 0 || (tracker.ResetAfter > 0 && now.Sub(attempts.last_failure) > tracker.ResetAfter)
+}
+
+func (tracker *LoginAttemptTracker) remove(attempts *loginAttempts) {
+	tracker.recent.Remove(attempts.element)
+	delete(tracker.attempts, attempts.key)
+}
+
+// sweep forgets expired attempts at most once per SweepInterval.
+func (tracker *LoginAttemptTracker) sweep(now time.Time) {
+	if tracker.attempts == nil {
+		tracker.attempts = make(map[string]*loginAttempts)
+	}
+	if tracker.recent == nil {
+		tracker.recent = list.New()
+	}
+	if now.Before(tracker.next_sweep) {
+		return
+	}
+	tracker.next_sweep = now.Add(tracker.SweepInterval)
+	for _, attempts := range tracker.attempts {
+		if tracker.expired(attempts, now) {
+			tracker.remove(attempts)
+		}
+	}
+}
+
+func (tracker *LoginAttemptTracker) backoff(excess int) time.Duration {
+	delay := tracker.BaseDelay
+	for i := 1; i < excess; i++ {
+		delay *= 2
+		if tracker.MaxDelay > 0 && delay >= tracker.MaxDelay {
+			return tracker.MaxDelay
+		}
+	}
+	return delay
+}
+
+func loginAttemptKeys(user, ip string) []string {
+	return []string{"user:" + user, "ip:" + ip}
+}
+
+// CheckLogin returns a LoginThrottledError if login attempts for
+// the user from the requesting client are currently throttled,
+// otherwise reserving an attempt as LoginAttemptTracker.Check does.
+func (context *RequestContext) CheckLogin(user string) error {
+	if context.loginTracker == nil {
+		return nil
+	}
+	return context.loginTracker.Check(user, context.ClientIP())
+}
+
+// ReleaseLogin returns the attempt reserved by CheckLogin for the
+// user when it was neither failed nor successful.
+func (context *RequestContext) ReleaseLogin(user string) {
+	if context.loginTracker != nil {
+		context.loginTracker.Release(user, context.ClientIP())
+	}
+}
+
+// LoginFailed records a failed login attempt for the user from
+// the requesting client.
+func (context *RequestContext) LoginFailed(user string) {
+	if context.loginTracker != nil {
+		context.loginTracker.Failure(user, context.ClientIP())
+	}
+}
+
+// AttemptLogin checks the login is not throttled, verifies the
+// credentials using the given function, and starts a session for
+// the user on success.  A failed verification is recorded and
+// returns ErrInvalidLogin.
+func (context *RequestContext) AttemptLogin(user string, verify func() bool) error {
+	if err := context.CheckLogin(user); err != nil {
+		return err
+	}
+	if !verify() {
+		context.LoginFailed(user)
+		return ErrInvalidLogin
+	}
+	context.StartSession(user)
+	return nil
+}
@@ -0,0 +1,163 @@
+package mcgoweb
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoginAttemptBackoff(t *testing.T) {
+	tracker := NewLoginAttemptTracker()
+	tracker.FreeAttempts = 1
+	tracker.BaseDelay = time.Minute
+	tracker.MaxDelay = 2 * time.Minute
+	tracker.LockoutThreshold = 4
+	var locked []LoginAttemptEvent
+	tracker.Notify = func(event LoginAttemptEvent) {
+		locked = append(locked, event)
+	}
+
+	tracker.Failure("admin", "10.0.0.1")
+	if err := tracker.Check("admin", "10.0.0.1"); err != nil {
+		t.Fatalf("Unexpected throttle after free attempt: %s", err)
+	}
+
+	expected_delays := []time.Duration{time.Minute, 2 * time.Minute, tracker.LockoutDuration}
+	for _, expected := range expected_delays {
+		tracker.Failure("admin", "10.0.0.1")
+		err, ok := tracker.Check("admin", "10.0.0.2").(*LoginThrottledError)
+		if !ok {
+			t.Fatalf("Expected login for user to be throttled")
+		}
+		if err.RetryAfter > expected || err.RetryAfter < expected-time.Second {
+			t.Errorf("Unexpected retry after...\nExpected: %s\nActual: %s", expected, err.RetryAfter)
+		}
+	}
+	if len(locked) != 2 {
+		t.Fatalf("Unexpected lockout notifications %d, expected 2", len(locked))
+	}
+	if locked[0].User != "admin" || locked[0].Failures != 4 {
+		t.Errorf("Unexpected lockout event %+v", locked[0])
+	}
+
+	tracker.Success("admin", "10.0.0.1")
+	if err := tracker.Check("admin", "10.0.0.2"); err != nil {
+		t.Errorf("Unexpected throttle after success: %s", err)
+	}
+	if err := tracker.Check("other", "10.0.0.1"); err == nil {
+		t.Errorf("Expected source IP to remain throttled after success")
+	}
+}
+
+func TestLoginAttemptReservation(t *testing.T) {
+	tracker := NewLoginAttemptTracker()
+	tracker.FreeAttempts = 2
+
+	var wait sync.WaitGroup
+	var lock sync.Mutex
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			if tracker.Check("admin", "10.0.0.1") == nil {
+				lock.Lock()
+				allowed++
+				lock.Unlock()
+			}
+		}()
+	}
+	wait.Wait()
+	if allowed != 2 {
+		t.Fatalf("Unexpected concurrent attempts %d, expected 2", allowed)
+	}
+
+	tracker.Release("admin", "10.0.0.1")
+	if err := tracker.Check("admin", "10.0.0.1"); err != nil {
+		t.Errorf("Unexpected throttle after released attempt: %s", err)
+	}
+
+	tracker.AttemptTimeout = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	if err := tracker.Check("admin", "10.0.0.1"); err != nil {
+		t.Errorf("Unexpected throttle after attempts timed out: %s", err)
+	}
+}
+
+func TestLoginAttemptLimit(t *testing.T) {
+	tracker := NewLoginAttemptTracker()
+	tracker.MaxEntries = 4
+	for i := 0; i < 10; i++ {
+		tracker.Failure(fmt.Sprint("user", i), fmt.Sprint("10.0.0.", i))
+	}
+	if len(tracker.attempts) != 4 || tracker.recent.Len() != 4 {
+		t.Fatalf("Unexpected tracked entries %d, expected 4", len(tracker.attempts))
+	}
+	if _, ok := tracker.attempts["user:user9"]; !ok {
+		t.Errorf("Expected most recent user to be tracked")
+	}
+
+	tracker.ResetAfter = time.Nanosecond
+	tracker.next_sweep = time.Time{}
+	time.Sleep(time.Millisecond)
+	tracker.Check("other", "10.0.0.100")
+	if len(tracker.attempts) != 2 {
+		t.Errorf("Unexpected tracked entries %d after sweep, expected 2", len(tracker.attempts))
+	}
+}
+
+func TestAttemptLogin(t *testing.T) {
+	var login_err error
+	NewTestHandler := func() *Handler {
+		handler := NewHandler("/login", HTTP_POST)
+		handler.RequestHandler = func(context *RequestContext) {
+			password := context.Request.Header.Get("X-Password")
+			login_err = context.AttemptLogin("admin", func() bool {
+				return password == "secret"
+			})
+		}
+		return handler
+	}
+
+	tracker := NewLoginAttemptTracker()
+	tracker.FreeAttempts = 1
+	app := NewHTTPApplication("Login Test", "/", "0.0.0.0:7654")
+	app.SetSessionCache(NewMemorySessionCache())
+	app.SetLoginAttemptTracker(tracker)
+	if _, err := app.Register(NewTestHandler); err != nil {
+		t.Fatalf("Unexpected error registering handler: %s", err)
+	}
+
+	login := func(password string) *httptest.ResponseRecorder {
+		request := createTestRequest("/login")
+		request.Method = "POST"
+		request.RemoteAddr = "10.0.0.1:4242"
+		request.Header = make(http.Header)
+		request.Header.Set("X-Password", password)
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		return response
+	}
+
+	login("guess")
+	if login_err != ErrInvalidLogin {
+		t.Fatalf("Unexpected login error %v, expected %v", login_err, ErrInvalidLogin)
+	}
+	login("secret")
+	if login_err != nil {
+		t.Fatalf("Unexpected login error %v", login_err)
+	}
+
+	login("guess")
+	login("guess")
+	response := login("secret")
+	if _, ok := login_err.(*LoginThrottledError); !ok {
+		t.Fatalf("Unexpected login error %v, expected throttled login", login_err)
+	}
+	if cookie := response.Header().Get("Set-Cookie"); cookie != "" {
+		t.Errorf("Unexpected session cookie for throttled login: %s", cookie)
+	}
+}
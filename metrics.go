@@ -0,0 +1,225 @@
+package mcgoweb
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultMetricsBuckets are the upper bounds, in seconds, of the
+// latency histograms of new Metrics.
+var DefaultMetricsBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// SessionCounter is implemented by a SessionCache able to report
+// the number of sessions it holds.
+type SessionCounter interface {
+	Count() int
+}
+
+// Metrics collects request metrics for an application and serves
+// them in the Prometheus text exposition format.  Requests are
+// labeled by route pattern, method and status class so the number
+// of series does not depend on the requested paths.  Requests which
+// match no route are labeled with an empty route.
+//
+// Metrics is an http.Handler and may be mounted on the application
+// it instruments or served separately.
+type Metrics struct {
+	Buckets []float64
+
+	start      time.Time
+	inFlight   atomic.Int64
+	lock       sync.Mutex
+	requests   map[string]*histogram
+	middleware map[string]*histogram
+	sessions   func() (int, bool)
+}
+
+type histogram struct {
+	labels string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewMetrics returns new metrics using the default buckets.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		Buckets:    DefaultMetricsBuckets,
+		start:      time.Now(),
+		requests:   make(map[string]*histogram),
+		middleware: make(map[string]*histogram),
+	}
+}
+
+// SetMetrics sets the metrics recording the application's requests.
+// Every request is recorded, including requests which match no
+// route, along with the time spent in each middleware.
+func (app *HTTPApplication) SetMetrics(metrics *Metrics) {
+	metrics.sessions = func() (int, bool) {
+		if counter, ok := app.sessionCache.(SessionCounter); ok {
+			return counter.Count(), true
+		}
+		return 0, false
+	}
+	app.metrics = metrics
+}
+
+func (metrics *Metrics) begin() time.Time {
+	metrics.inFlight.Add(1)
+	return time.Now()
+}
+
+func (metrics *Metrics) end(context *RequestContext, start time.Time) {
+	metrics.inFlight.Add(-1)
+	route := ""
+	if context.route != nil {
+		route = context.route.Host + context.route.Path
+	}
+	status := 0
+	if context.response != nil {
+		status = context.response.Status()
+	}
+	if status == 0 {
+		status = http.StatusOK
+	}
+	labels := formatLabels("route", route, "method", metricsMethod(context.Request.Method), "status", strconv.Itoa(status/100)+"xx")
+	metrics.observe(metrics.requests, labels, time.Since(start))
+}
+
+func (metrics *Metrics) observeMiddleware(name string, duration time.Duration) {
+	metrics.observe(metrics.middleware, formatLabels("middleware", name), duration)
+}
+
+func (metrics *Metrics) observe(series map[string]*histogram, labels string, duration time.Duration) {
+	seconds := duration.Seconds()
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+	observed, ok := series[labels]
+	if !ok {
+		observed = &histogram{labels: labels, counts: make([]uint64, len(metrics.Buckets))}
+		series[labels] = observed
+	}
+	for i, bound := range metrics.Buckets {
+		if seconds <= bound {
+			observed.counts[i]++
+		}
+	}
+	observed.count++
+	observed.sum += seconds
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition
+// format.
+func (metrics *Metrics) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.WriteTo(writer)
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition
+// format.
+func (metrics *Metrics) WriteTo(writer io.Writer) (int64, error) {
+	var output strings.Builder
+
+	metrics.lock.Lock()
+	writeHistograms(&output, "mcgoweb_http_request_duration_seconds", "Duration of HTTP requests by route, method and status class.", metrics.Buckets, metrics.requests)
+	output.WriteString("# HELP mcgoweb_http_requests_total Total HTTP requests by route, method and status class.\n")
+	output.WriteString("# TYPE mcgoweb_http_requests_total counter\n")
+	for _, observed := range sortedHistograms(metrics.requests) {
+		fmt.Fprintf(&output, "mcgoweb_http_requests_total{%s} %d\n", observed.labels, observed.count)
+	}
+	writeHistograms(&output, "mcgoweb_middleware_duration_seconds", "Time spent in each middleware, excluding the handlers it calls.", metrics.Buckets, metrics.middleware)
+	metrics.lock.Unlock()
+
+	writeGauge(&output, "mcgoweb_http_requests_in_flight", "HTTP requests currently being served.", float64(metrics.inFlight.Load()))
+	if metrics.sessions != nil {
+		if sessions, ok := metrics.sessions(); ok {
+			writeGauge(&output, "mcgoweb_sessions_active", "Sessions held by the session cache.", float64(sessions))
+		}
+	}
+	writeGauge(&output, "mcgoweb_start_time_seconds", "Start time of the application since the Unix epoch in seconds.", float64(metrics.start.UnixNano())/1e9)
+	writeGauge(&output, "go_goroutines", "Number of goroutines that currently exist.", float64(runtime.NumGoroutine()))
+
+	n, err := io.WriteString(writer, output.String())
+	return int64(n), err
+}
+
+func writeHistograms(output *strings.Builder, name, help string, buckets []float64, series map[string]*histogram) {
+	fmt.Fprintf(output, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for _, observed := range sortedHistograms(series) {
+		for i, bound := range buckets {
+			fmt.Fprintf(output, "%s_bucket{%s,le=\"%s\"} %d\n", name, observed.labels, formatMetricValue(bound), observed.counts[i])
+		}
+		fmt.Fprintf(output, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, observed.labels, observed.count)
+		fmt.Fprintf(output, "%s_sum{%s} %s\n", name, observed.labels, formatMetricValue(observed.sum))
+		fmt.Fprintf(output, "%s_count{%s} %d\n", name, observed.labels, observed.count)
+	}
+}
+
+func writeGauge(output *strings.Builder, name, help string, value float64) {
+	fmt.Fprintf(output, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", name, help, name, name, formatMetricValue(value))
+}
+
+func sortedHistograms(series map[string]*histogram) []*histogram {
+	sorted := make([]*histogram, 0, len(series))
+	for _, observed := range series {
+		sorted = append(sorted, observed)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].labels < sorted[j].labels
+	})
+	return sorted
+}
+
+// formatLabels formats name and value pairs as Prometheus labels.
+func formatLabels(pairs ...string) string {
+	labels := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(pairs[i+1])
+		labels = append(labels, pairs[i]+`="`+value+`"`)
+	}
+	return strings.Join(labels, ",")
+}
+
+func formatMetricValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// metricsMethod limits method labels to the methods routes handle.
+func metricsMethod(method string) string {
+	if _, ok := HTTP_METHOD_MAP[method]; ok {
+		return method
+	}
+	return "OTHER"
+}
+
+// instrumentMiddleware returns the middleware recording the time
+// spent in it, excluding the handler it calls, when the application
+// has metrics, and tracing it when the request is traced.
+func instrumentMiddleware(middleware Middleware, name string) Middleware {
+	return func(handler RequestHandler, context *RequestContext) {
+		if context.application == nil || context.application.metrics == nil {
+			traceMiddlewareStage(middleware, name, handler, context)
+			return
+		}
+		var inner atomic.Int64
+		start := time.Now()
+		traceMiddlewareStage(middleware, name, func(context *RequestContext) {
+			handler_start := time.Now()
+			handler(context)
+			inner.Add(int64(time.Since(handler_start)))
+		}, context)
+		context.application.metrics.observeMiddleware(name, time.Since(start)-time.Duration(inner.Load()))
+	}
+}
@@ -0,0 +1,75 @@
+package mcgoweb
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	app := NewHTTPApplication("Metrics Test", "/", "0.0.0.0:7654")
+	app.SetSessionCache(NewMemorySessionCache())
+	metrics := NewMetrics()
+	app.SetMetrics(metrics)
+	app.AddMiddleware(SessionMiddleware)
+
+	handler := NewHandler("/users/<id:int>", HTTP_GET)
+	handler.RequestHandler = func(context *RequestContext) {
+		context.StartSession("user" + context.RequestVars["id"])
+	}
+	if _, err := app.RegisterHandler(handler); err != nil {
+		t.Fatalf("Unexpected error registering handler: %s", err)
+	}
+	if _, err := app.Mount("/metrics", metrics); err != nil {
+		t.Fatalf("Unexpected error mounting metrics: %s", err)
+	}
+
+	for _, path := range []string{"/users/1", "/users/2", "/missing"} {
+		request := createTestRequest(path)
+		request.Header = make(map[string][]string)
+		app.ServeHTTP(httptest.NewRecorder(), request)
+	}
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, createTestRequest("/metrics"))
+	if actual := response.Header().Get("Content-Type"); !strings.HasPrefix(actual, "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected metrics content type '%s'", actual)
+	}
+
+	body := response.Body.String()
+	for _, expected := range []string{
+		"# TYPE mcgoweb_http_requests_total counter\n",
+		`mcgoweb_http_requests_total{route="/users/<id:int>",method="GET",status="2xx"} 2` + "\n",
+		`mcgoweb_http_requests_total{route="",method="GET",status="4xx"} 1` + "\n",
+		`mcgoweb_http_request_duration_seconds_bucket{route="/users/<id:int>",method="GET",status="2xx",le="+Inf"} 2` + "\n",
+		`mcgoweb_middleware_duration_seconds_count{middleware="mcgoweb.SessionMiddleware"} 2` + "\n",
+		"mcgoweb_http_requests_in_flight 1\n",
+		"mcgoweb_sessions_active 2\n",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Metrics missing %q\n%s", expected, body)
+		}
+	}
+}
+
+func TestMemorySessionCacheCount(t *testing.T) {
+	cache := NewMemorySessionCache()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			NewUserSession("user", cache).Store()
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		cache.(SessionCounter).Count()
+	}
+	<-done
+
+	expired := NewUserSession("expired", cache)
+	expired.expiration = time.Now().Add(-time.Minute)
+	expired.Store()
+	if actual := cache.(SessionCounter).Count(); actual != 100 {
+		t.Errorf("Unexpected session count %d, expected 100", actual)
+	}
+}
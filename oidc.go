@@ -0,0 +1,452 @@
+package mcgoweb
+
+import (
+	stdcontext "context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OIDCConfiguration represents the configuration of an OpenID
+// Connect login blueprint.  RedirectURL must be the absolute URL
+// of the blueprint's callback handler as registered with the
+// identity provider.
+type OIDCConfiguration struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	SuccessPath  string
+	HTTPClient   *http.Client
+
+	// MapUser returns the session user for the verified ID token
+	// claims.  An error denies the login.  By default the subject
+	// claim is used as the user.
+	MapUser func(claims map[string]interface{}) (string, error)
+}
+
+// OIDCDiscovery represents the provider metadata used by the
+// OpenID Connect login blueprint.
+type OIDCDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+const (
+	oidcStateKey    = "oidc_state"
+	oidcNonceKey    = "oidc_nonce"
+	oidcVerifierKey = "oidc_verifier"
+)
+
+// IDTokenClockSkew is the leeway allowed when validating the
+// expiration and issue time of an ID token.
+var IDTokenClockSkew time.Duration = time.Minute
+
+// JWKSRefreshInterval is the shortest time between fetches of the
+// provider's signing keys.  Tokens signed by an unknown key cause
+// the keys to be fetched again, in case they have been rotated,
+// at most once per interval.
+var JWKSRefreshInterval time.Duration = time.Minute
+
+type oidcClient struct {
+	config OIDCConfiguration
+
+	mutex        sync.Mutex
+	discovery    *OIDCDiscovery
+	keys         map[string]*rsa.PublicKey
+	keys_fetched time.Time
+}
+
+// NewOIDCBlueprint returns a new blueprint at the given path which
+// signs users in through an OpenID Connect provider using the
+// authorization code flow with PKCE.
+//
+// The "/login" handler redirects to the provider, keeping the
+// state, nonce, and code verifier in an anonymous session.  The
+// "/callback" handler exchanges the code, verifies the ID token,
+// and starts a session for the mapped user before redirecting to
+// the SuccessPath.
+//
+// The blueprint keeps the login in sessions, so the application
+// must have a session cache set with SetSessionCache.  Without one
+// logins fail with 500 Internal Server Error.
+func NewOIDCBlueprint(path string, config OIDCConfiguration) *Blueprint {
+	if config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+		panic("mcgoweb: OIDC configuration requires an issuer, client id, and redirect url")
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "profile", "email"}
+	}
+	if config.SuccessPath == "" {
+		config.SuccessPath = "/"
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	if config.MapUser == nil {
+		config.MapUser = oidcSubject
+	}
+	client := &oidcClient{config: config}
+
+	blueprint := NewBlueprint(path)
+	blueprint.AddMiddleware(SessionMiddleware)
+
+	login := NewHandler("/login", HTTP_GET)
+	login.RequestHandler = client.login
+	blueprint.RegisterHandler(login)
+
+	callback := NewHandler("/callback", HTTP_GET)
+	callback.RequestHandler = client.callback
+	blueprint.RegisterHandler(callback)
+
+	return blueprint
+}
+
+func (client *oidcClient) login(context *RequestContext) {
+	if context.sessionCache == nil {
+		log.Println("OIDC login requires a session cache, see SetSessionCache")
+		http.Error(context.Writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	discovery, err := client.getDiscovery(context.Context())
+	if err != nil {
+		log.Println("OIDC discovery failed:", err)
+		http.Error(context.Writer, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+
+	state, err1 := randomToken()
+	nonce, err2 := randomToken()
+	verifier, err3 := randomToken()
+	if err1 != nil || err2 != nil || err3 != nil {
+		http.Error(context.Writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if context.Session == nil {
+		context.StartSession("")
+	}
+	context.Session.UpdateValue(oidcStateKey, state)
+	context.Session.UpdateValue(oidcNonceKey, nonce)
+	context.Session.UpdateValue(oidcVerifierKey, verifier)
+
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", client.config.ClientID)
+	query.Set("redirect_uri", client.config.RedirectURL)
+	query.Set("scope", strings.Join(client.config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+
+	location := discovery.AuthorizationEndpoint
+	if strings.Contains(location, "?") {
+		location += "&" + query.Encode()
+	} else {
+		location += "?" + query.Encode()
+	}
+	http.Redirect(context.Writer, context.Request, location, http.StatusFound)
+}
+
+func (client *oidcClient) callback(context *RequestContext) {
+	if context.Session == nil {
+		http.Error(context.Writer, "Missing login session", http.StatusBadRequest)
+		return
+	}
+	state, _ := context.Session.GetValue(oidcStateKey)
+	nonce, _ := context.Session.GetValue(oidcNonceKey)
+	verifier, _ := context.Session.GetValue(oidcVerifierKey)
+	// The values are single use regardless of the outcome.
+	context.Session.UpdateValue(oidcStateKey, "")
+	context.Session.UpdateValue(oidcNonceKey, "")
+	context.Session.UpdateValue(oidcVerifierKey, "")
+
+	query := context.Request.URL.Query()
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(query.Get("state"))) != 1 {
+		http.Error(context.Writer, "Invalid login state", http.StatusBadRequest)
+		return
+	}
+	if provider_error := query.Get("error"); provider_error != "" {
+		http.Error(context.Writer, "Login failed: "+provider_error, http.StatusUnauthorized)
+		return
+	}
+
+	id_token, err := client.exchange(context.Context(), query.Get("code"), verifier)
+	if err != nil {
+		log.Println("OIDC token exchange failed:", err)
+		http.Error(context.Writer, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+	claims, err := client.verify(context.Context(), id_token, nonce)
+	if err != nil {
+		log.Println("OIDC ID token rejected:", err)
+		http.Error(context.Writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	user, err := client.config.MapUser(claims)
+	if err != nil || user == "" {
+		http.Error(context.Writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	context.StartSession(user)
+	http.Redirect(context.Writer, context.Request, client.config.SuccessPath, http.StatusFound)
+}
+
+func (client *oidcClient) getDiscovery(ctx stdcontext.Context) (*OIDCDiscovery, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	if client.discovery != nil {
+		return client.discovery, nil
+	}
+
+	discovery := new(OIDCDiscovery)
+	discovery_url := strings.TrimRight(client.config.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := client.getJSON(ctx, discovery_url, discovery); err != nil {
+		return nil, err
+	}
+	if discovery.Issuer != client.config.Issuer {
+		return nil, fmt.Errorf("discovery issuer %q does not match %q", discovery.Issuer, client.config.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("discovery document missing required endpoints")
+	}
+	client.discovery = discovery
+	return discovery, nil
+}
+
+func (client *oidcClient) exchange(ctx stdcontext.Context, code, verifier string) (string, error) {
+	discovery, err := client.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", client.config.RedirectURL)
+	form.Set("code_verifier", verifier)
+	form.Set("client_id", client.config.ClientID)
+
+	request, err := http.NewRequestWithContext(ctx, "POST", discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if client.config.ClientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(client.config.ClientID), url.QueryEscape(client.config.ClientSecret))
+	}
+
+	response, err := client.config.HTTPClient.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned %s: %s", response.Status, body)
+	}
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", err
+	}
+	if token.IDToken == "" {
+		return "", errors.New("token response missing id_token")
+	}
+	return token.IDToken, nil
+}
+
+func (client *oidcClient) verify(ctx stdcontext.Context, id_token, nonce string) (map[string]interface{}, error) {
+	parts := strings.Split(id_token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyId     string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header.Algorithm != "RS256" {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", header.Algorithm)
+	}
+	key, err := client.getKey(ctx, header.KeyId)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, err
+	}
+
+	claims := make(map[string]interface{})
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if issuer, _ := claims["iss"].(string); issuer != client.config.Issuer {
+		return nil, fmt.Errorf("unexpected issuer %q", issuer)
+	}
+	if !oidcAudienceContains(claims["aud"], client.config.ClientID) {
+		return nil, errors.New("token not issued for this client")
+	}
+	if party, ok := claims["azp"].(string); ok && party != client.config.ClientID {
+		return nil, fmt.Errorf("unexpected authorized party %q", party)
+	}
+	now := time.Now()
+	expiration, ok := claims["exp"].(float64)
+	if !ok || now.Add(-IDTokenClockSkew).After(time.Unix(int64(expiration), 0)) {
+		return nil, errors.New("token expired")
+	}
+	if issued, ok := claims["iat"].(float64); ok && time.Unix(int64(issued), 0).After(now.Add(IDTokenClockSkew)) {
+		return nil, errors.New("token issued in the future")
+	}
+	if token_nonce, _ := claims["nonce"].(string); nonce == "" || token_nonce != nonce {
+		return nil, errors.New("token nonce mismatch")
+	}
+	return claims, nil
+}
+
+func (client *oidcClient) getKey(ctx stdcontext.Context, key_id string) (*rsa.PublicKey, error) {
+	// Unknown keys may have been rotated in since the last fetch,
+	// but are refetched at most once per JWKSRefreshInterval so
+	// tokens with made up key ids can not cause a fetch each.
+	client.mutex.Lock()
+	key, ok := client.keys[key_id]
+	fetch := !ok && time.Since(client.keys_fetched) >= JWKSRefreshInterval
+	if fetch {
+		client.keys_fetched = time.Now()
+	}
+	client.mutex.Unlock()
+	if ok {
+		return key, nil
+	}
+	if !fetch {
+		return nil, fmt.Errorf("unknown signing key %q", key_id)
+	}
+
+	discovery, err := client.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var key_set struct {
+		Keys []struct {
+			KeyType  string `json:"kty"`
+			KeyId    string `json:"kid"`
+			Modulus  string `json:"n"`
+			Exponent string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := client.getJSON(ctx, discovery.JWKSURI, &key_set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, json_key := range key_set.Keys {
+		if json_key.KeyType != "RSA" {
+			continue
+		}
+		modulus, err1 := base64.RawURLEncoding.DecodeString(json_key.Modulus)
+		exponent, err2 := base64.RawURLEncoding.DecodeString(json_key.Exponent)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		keys[json_key.KeyId] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(modulus),
+			E: int(new(big.Int).SetBytes(exponent).Int64()),
+		}
+	}
+
+	client.mutex.Lock()
+	client.keys = keys
+	client.mutex.Unlock()
+	if key, ok = keys[key_id]; !ok {
+		return nil, fmt.Errorf("unknown signing key %q", key_id)
+	}
+	return key, nil
+}
+
+func (client *oidcClient) getJSON(ctx stdcontext.Context, location string, value interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, "GET", location, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.config.HTTPClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", location, response.Status)
+	}
+	return json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(value)
+}
+
+func oidcSubject(claims map[string]interface{}) (string, error) {
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return "", errors.New("token missing subject")
+	}
+	return subject, nil
+}
+
+func oidcAudienceContains(audience interface{}, client_id string) bool {
+	switch audience := audience.(type) {
+	case string:
+		return audience == client_id
+	case []interface{}:
+		for _, value := range audience {
+			if value == client_id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeJWTPart(part string, value interface{}) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(decoded, value)
+}
+
+func randomToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
@@ -0,0 +1,152 @@
+package mcgoweb
+
+import (
+	stdcontext "context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/dmcgowan/mcgoweb/oidctest"
+)
+
+func TestOIDCBlueprint(t *testing.T) {
+	provider := oidctest.NewProvider("console", "console-secret")
+	defer provider.Close()
+	provider.SetUser("0b9e2c", map[string]interface{}{"email": "ops@example.com"})
+
+	cache := NewMemorySessionCache()
+	app := NewHTTPApplication("OIDC Test", "/", "0.0.0.0:7654")
+	app.SetSessionCache(cache)
+	if _, err := app.RegisterBlueprint(NewOIDCBlueprint("/auth", OIDCConfiguration{
+		Issuer:       provider.Issuer,
+		ClientID:     "console",
+		ClientSecret: "console-secret",
+		RedirectURL:  "http://console.example/auth/callback",
+		SuccessPath:  "/console",
+		MapUser: func(claims map[string]interface{}) (string, error) {
+			email, _ := claims["email"].(string)
+			return email, nil
+		},
+	})); err != nil {
+		t.Fatalf("Unexpected error registering blueprint: %s", err)
+	}
+
+	request := func(location string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		request := createTestRequest(location)
+		request.Header = make(http.Header)
+		if cookie != nil {
+			request.AddCookie(cookie)
+		}
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		return response
+	}
+	sessionCookie := func(response *httptest.ResponseRecorder) *http.Cookie {
+		for _, cookie := range response.Result().Cookies() {
+			if cookie.Name == "SID" {
+				return cookie
+			}
+		}
+		t.Fatalf("Missing session cookie in response")
+		return nil
+	}
+
+	response := request("/auth/login", nil)
+	if response.Code != 302 {
+		t.Fatalf("Unexpected response code %d, expected 302", response.Code)
+	}
+	login_cookie := sessionCookie(response)
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	provider_response, err := client.Get(response.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("Authorization request failed: %s", err)
+	}
+	provider_response.Body.Close()
+	callback, err := url.Parse(provider_response.Header.Get("Location"))
+	if err != nil || callback.Path != "/auth/callback" {
+		t.Fatalf("Unexpected authorization redirect '%s'", provider_response.Header.Get("Location"))
+	}
+
+	forged := callback.Query()
+	forged.Set("state", "forged")
+	response = request(callback.Path+"?"+forged.Encode(), login_cookie)
+	if response.Code != 400 {
+		t.Errorf("Unexpected response code %d for forged state, expected 400", response.Code)
+	}
+
+	// The forged attempt consumed the login state, start over.
+	response = request("/auth/login", login_cookie)
+	provider_response, err = client.Get(response.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("Authorization request failed: %s", err)
+	}
+	provider_response.Body.Close()
+	callback, _ = url.Parse(provider_response.Header.Get("Location"))
+
+	response = request(callback.Path+"?"+callback.RawQuery, login_cookie)
+	if response.Code != 302 {
+		t.Fatalf("Unexpected response code %d, expected 302\n%s", response.Code, response.Body.String())
+	}
+	if expected := "/console"; response.Header().Get("Location") != expected {
+		t.Errorf("Unexpected redirect...\nExpected: '%s'\nActual: '%s'", expected, response.Header().Get("Location"))
+	}
+	session := GetSession(sessionCookie(response).Value, cache)
+	if session == nil {
+		t.Fatalf("Missing session for login")
+	}
+	if user, _ := session.GetValue("user"); user != "ops@example.com" {
+		t.Errorf("Unexpected session user...\nExpected: 'ops@example.com'\nActual: '%s'", user)
+	}
+	if GetSession(login_cookie.Value, cache) != nil {
+		t.Errorf("Anonymous login session not expired after login")
+	}
+}
+
+type countingTransport struct {
+	requests map[string]int
+}
+
+func (transport *countingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	transport.requests[request.URL.Path]++
+	return http.DefaultTransport.RoundTrip(request)
+}
+
+func TestOIDCSigningKeyRefresh(t *testing.T) {
+	provider := oidctest.NewProvider("console", "console-secret")
+	defer provider.Close()
+
+	transport := &countingTransport{requests: make(map[string]int)}
+	client := &oidcClient{config: OIDCConfiguration{
+		Issuer:     provider.Issuer,
+		HTTPClient: &http.Client{Transport: transport},
+	}}
+	for i := 0; i < 3; i++ {
+		if _, err := client.getKey(stdcontext.Background(), "unknown"); err == nil {
+			t.Errorf("Expected unknown signing key to be rejected")
+		}
+	}
+	if _, err := client.getKey(stdcontext.Background(), "test-key"); err != nil {
+		t.Errorf("Unexpected error for known signing key: %s", err)
+	}
+	if actual := transport.requests["/keys"]; actual != 1 {
+		t.Errorf("Unexpected signing key fetches %d, expected 1", actual)
+	}
+
+	app := NewHTTPApplication("OIDC Test", "/", "0.0.0.0:7654")
+	if _, err := app.RegisterBlueprint(NewOIDCBlueprint("/auth", OIDCConfiguration{
+		Issuer:      provider.Issuer,
+		ClientID:    "console",
+		RedirectURL: "http://console.example/auth/callback",
+	})); err != nil {
+		t.Fatalf("Unexpected error registering blueprint: %s", err)
+	}
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, createTestRequest("/auth/login"))
+	if response.Code != 500 {
+		t.Errorf("Unexpected response code %d without a session cache, expected 500", response.Code)
+	}
+}
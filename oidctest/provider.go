@@ -0,0 +1,246 @@
+/*
+Package oidctest provides an in-process OpenID Connect provider
+for testing applications using the mcgoweb OIDC login blueprint.
+
+The provider implements discovery, the authorization endpoint,
+the token endpoint with PKCE verification, and a JWKS endpoint.
+Authorization requests are approved immediately for the
+configured user without any interaction.
+*/
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Provider represents a fake OpenID Connect provider serving
+// on a local test server.
+type Provider struct {
+	Server       *httptest.Server
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+
+	key    *rsa.PrivateKey
+	key_id string
+
+	mutex   sync.Mutex
+	subject string
+	claims  map[string]interface{}
+	codes   map[string]*authorization
+}
+
+type authorization struct {
+	redirect_uri string
+	nonce        string
+	challenge    string
+	subject      string
+	claims       map[string]interface{}
+}
+
+// NewProvider returns a new running Provider accepting the given
+// client credentials.  The provider must be closed when done.
+func NewProvider(client_id, client_secret string) *Provider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	provider := new(Provider)
+	provider.ClientID = client_id
+	provider.ClientSecret = client_secret
+	provider.key = key
+	provider.key_id = "test-key"
+	provider.subject = "test-user"
+	provider.codes = make(map[string]*authorization)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", provider.serveDiscovery)
+	mux.HandleFunc("/authorize", provider.serveAuthorize)
+	mux.HandleFunc("/token", provider.serveToken)
+	mux.HandleFunc("/keys", provider.serveKeys)
+	provider.Server = httptest.NewServer(mux)
+	provider.Issuer = provider.Server.URL
+	return provider
+}
+
+// Close shuts down the provider's server.
+func (provider *Provider) Close() {
+	provider.Server.Close()
+}
+
+// SetUser sets the subject and additional claims of the user
+// signed in by subsequent authorization requests.
+func (provider *Provider) SetUser(subject string, claims map[string]interface{}) {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+	provider.subject = subject
+	provider.claims = claims
+}
+
+func (provider *Provider) serveDiscovery(writer http.ResponseWriter, request *http.Request) {
+	writeJSON(writer, map[string]interface{}{
+		"issuer":                                provider.Issuer,
+		"authorization_endpoint":                provider.Issuer + "/authorize",
+		"token_endpoint":                        provider.Issuer + "/token",
+		"jwks_uri":                              provider.Issuer + "/keys",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (provider *Provider) serveAuthorize(writer http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+	if query.Get("client_id") != provider.ClientID {
+		http.Error(writer, "unknown client", http.StatusBadRequest)
+		return
+	}
+	redirect_uri, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || !redirect_uri.IsAbs() {
+		http.Error(writer, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if query.Get("response_type") != "code" || query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(writer, "authorization code flow with S256 PKCE required", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString()
+	provider.mutex.Lock()
+	provider.codes[code] = &authorization{
+		redirect_uri: redirect_uri.String(),
+		nonce:        query.Get("nonce"),
+		challenge:    query.Get("code_challenge"),
+		subject:      provider.subject,
+		claims:       provider.claims,
+	}
+	provider.mutex.Unlock()
+
+	response := redirect_uri.Query()
+	response.Set("code", code)
+	response.Set("state", query.Get("state"))
+	redirect_uri.RawQuery = response.Encode()
+	http.Redirect(writer, request, redirect_uri.String(), http.StatusFound)
+}
+
+func (provider *Provider) serveToken(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != "POST" {
+		http.Error(writer, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	client_id, client_secret, ok := request.BasicAuth()
+	if !ok {
+		client_id = request.PostFormValue("client_id")
+		client_secret = request.PostFormValue("client_secret")
+	}
+	client_id, _ = url.QueryUnescape(client_id)
+	client_secret, _ = url.QueryUnescape(client_secret)
+	if client_id != provider.ClientID || client_secret != provider.ClientSecret {
+		tokenError(writer, "invalid_client", http.StatusUnauthorized)
+		return
+	}
+	if request.PostFormValue("grant_type") != "authorization_code" {
+		tokenError(writer, "unsupported_grant_type", http.StatusBadRequest)
+		return
+	}
+
+	code := request.PostFormValue("code")
+	provider.mutex.Lock()
+	auth, ok := provider.codes[code]
+	delete(provider.codes, code)
+	provider.mutex.Unlock()
+	if !ok || auth.redirect_uri != request.PostFormValue("redirect_uri") {
+		tokenError(writer, "invalid_grant", http.StatusBadRequest)
+		return
+	}
+	challenge := sha256.Sum256([]byte(request.PostFormValue("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(challenge[:]) != auth.challenge {
+		tokenError(writer, "invalid_grant", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	claims := map[string]interface{}{}
+	for name, value := range auth.claims {
+		claims[name] = value
+	}
+	claims["iss"] = provider.Issuer
+	claims["sub"] = auth.subject
+	claims["aud"] = provider.ClientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(time.Hour).Unix()
+	if auth.nonce != "" {
+		claims["nonce"] = auth.nonce
+	}
+
+	writeJSON(writer, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     provider.SignToken(claims),
+	})
+}
+
+func (provider *Provider) serveKeys(writer http.ResponseWriter, request *http.Request) {
+	public_key := provider.key.PublicKey
+	writeJSON(writer, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": provider.key_id,
+			"n":   base64.RawURLEncoding.EncodeToString(public_key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public_key.E)).Bytes()),
+		}},
+	})
+}
+
+// SignToken returns a JWT with the given claims signed by the
+// provider's key, allowing tests to construct invalid tokens.
+func (provider *Provider) SignToken(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": provider.key_id})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		panic(err)
+	}
+	signing_input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signing_input))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, provider.key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return signing_input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func tokenError(writer http.ResponseWriter, code string, status int) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	json.NewEncoder(writer).Encode(map[string]string{"error": code})
+}
+
+func writeJSON(writer http.ResponseWriter, value interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(writer).Encode(value)
+}
+
+func randomString() string {
+	value := make([]byte, 24)
+	if _, err := rand.Read(value); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(value)
+}
@@ -0,0 +1,94 @@
+package mcgoweb
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidPasswordHash is returned when verifying a password
+// against a hash not created by a PasswordHasher.
+var ErrInvalidPasswordHash = errors.New("mcgoweb: invalid password hash")
+
+// PasswordHasher represents the parameters used to hash passwords
+// with PBKDF2-SHA256.  The parameters are encoded in each hash, so
+// increasing them does not invalidate existing hashes.
+type PasswordHasher struct {
+	Iterations int
+	SaltLength int
+	KeyLength  int
+}
+
+// DefaultPasswordHasher is used when no PasswordHasher is
+// configured.
+var DefaultPasswordHasher = &PasswordHasher{
+	Iterations: 600000,
+	SaltLength: 16,
+	KeyLength:  32,
+}
+
+const passwordHashPrefix = "$pbkdf2-sha256$"
+
+// Hash returns the encoded hash of the password, in the form
+// $pbkdf2-sha256$i=<iterations>,l=<length>$<salt>$<key>.
+func (hasher *PasswordHasher) Hash(password string) (string, error) {
+	salt := make([]byte, hasher.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, hasher.Iterations, hasher.KeyLength)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%si=%d,l=%d$%s$%s", passwordHashPrefix, hasher.Iterations, hasher.KeyLength,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify returns whether the password matches the encoded hash,
+// using the parameters stored in the hash.
+func (hasher *PasswordHasher) Verify(password, encoded string) (bool, error) {
+	iterations, _, salt, key, err := parsePasswordHash(encoded)
+	if err != nil {
+		return false, err
+	}
+	derived, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(key))
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(derived, key) == 1, nil
+}
+
+// NeedsUpgrade returns whether the encoded hash was created with
+// weaker parameters than the hasher's and should be replaced the
+// next time the password is available.
+func (hasher *PasswordHasher) NeedsUpgrade(encoded string) bool {
+	iterations, key_length, salt, _, err := parsePasswordHash(encoded)
+	if err != nil {
+		return true
+	}
+	return iterations < hasher.Iterations || key_length < hasher.KeyLength || len(salt) < hasher.SaltLength
+}
+
+func parsePasswordHash(encoded string) (iterations, key_length int, salt, key []byte, err error) {
+	if !strings.HasPrefix(encoded, passwordHashPrefix) {
+		return 0, 0, nil, nil, ErrInvalidPasswordHash
+	}
+	parts := strings.Split(encoded[len(passwordHashPrefix):], "$")
+	if len(parts) != 3 {
+		return 0, 0, nil, nil, ErrInvalidPasswordHash
+	}
+	if _, err := fmt.Sscanf(parts[0], "i=%d,l=%d", &iterations, &key_length); err != nil || iterations < 1 {
+		return 0, 0, nil, nil, ErrInvalidPasswordHash
+	}
+	salt, err1 := base64.RawStdEncoding.DecodeString(parts[1])
+	key, err2 := base64.RawStdEncoding.DecodeString(parts[2])
+	if err1 != nil || err2 != nil || len(key) != key_length {
+		return 0, 0, nil, nil, ErrInvalidPasswordHash
+	}
+	return iterations, key_length, salt, key, nil
+}
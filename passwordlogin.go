@@ -0,0 +1,416 @@
+package mcgoweb
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PasswordLoginConfiguration represents the configuration of a
+// password login blueprint.
+//
+// Templates may override any of the "login", "change_password",
+// "totp", and "totp_enroll" templates.  Each is rendered with a
+// PasswordLoginPage as the TemplateData's Data.
+type PasswordLoginConfiguration struct {
+	Users             UserStore
+	Hasher            *PasswordHasher
+	Templates         *template.Template
+	SuccessPath       string
+	LogoutPath        string
+	MinPasswordLength int
+	TOTPIssuer        string
+}
+
+// PasswordLoginPage represents the data rendered by the password
+// login templates.
+type PasswordLoginPage struct {
+	User    string
+	Error   string
+	Message string
+	TOTP    *TOTPEnrollment
+}
+
+var defaultPasswordLoginTemplates = template.Must(template.New("password_login").Parse(`
+{{define "header"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.}}</title>
+</head>
+<body>
+<h1>{{.}}</h1>
+{{end}}
+{{define "messages"}}{{if .Error}}<p class="error">{{.Error}}</p>{{end}}{{if .Message}}<p class="message">{{.Message}}</p>{{end}}{{end}}
+{{define "login"}}{{template "header" "Sign in"}}{{template "messages" .Data}}
+<form method="post">
+<label>Username <input type="text" name="username" value="{{.Data.User}}" autocomplete="username" required autofocus></label>
+<label>Password <input type="password" name="password" autocomplete="current-password" required></label>
+<button type="submit">Sign in</button>
+</form>
+</body>
+</html>
+{{end}}
+{{define "change_password"}}{{template "header" "Change password"}}{{template "messages" .Data}}
+<form method="post">
+<label>Current password <input type="password" name="current_password" autocomplete="current-password" required></label>
+<label>New password <input type="password" name="new_password" autocomplete="new-password" required></label>
+<label>Confirm new password <input type="password" name="confirm_password" autocomplete="new-password" required></label>
+<button type="submit">Change password</button>
+</form>
+</body>
+</html>
+{{end}}
+{{define "totp"}}{{template "header" "Two-factor authentication"}}{{template "messages" .Data}}
+<form method="post">
+<label>Authentication or recovery code <input type="text" name="code" inputmode="numeric" autocomplete="one-time-code" required autofocus></label>
+<button type="submit">Verify</button>
+</form>
+</body>
+</html>
+{{end}}
+{{define "totp_enroll"}}{{template "header" "Enable two-factor authentication"}}{{template "messages" .Data}}
+{{with .Data.TOTP}}<p>Add this account to your authenticator app using the link or secret below.</p>
+<p><a href="{{.URI}}">{{.URI}}</a></p>
+<p><code>{{.Secret}}</code></p>
+<p>Keep these recovery codes somewhere safe, each can be used once if your device is lost.</p>
+<ul>{{range .RecoveryCodes}}<li><code>{{.}}</code></li>{{end}}</ul>
+<form method="post">
+<label>Authentication code <input type="text" name="code" inputmode="numeric" autocomplete="one-time-code" required autofocus></label>
+<button type="submit">Enable</button>
+</form>{{end}}
+</body>
+</html>
+{{end}}
+`))
+
+const (
+	totpEnrollmentSecretKey = "totp_enroll_secret"
+	totpEnrollmentCodesKey  = "totp_enroll_codes"
+)
+
+type passwordLogin struct {
+	config PasswordLoginConfiguration
+
+	dummy_once sync.Once
+	dummy_hash string
+}
+
+// NewPasswordLoginBlueprint returns a new blueprint at the given
+// path with "/login", "/logout", and "/password" handlers which
+// authenticate users from the configured UserStore.  Users with
+// TOTP enabled are sent to the "/totp" handler after their
+// password is verified, and "/totp/enroll" enables TOTP for the
+// signed in user.  "/logout" only accepts POST requests.
+//
+// Failed logins are throttled by the application's
+// LoginAttemptTracker.  Password hashes created with weaker
+// parameters than the configured hasher are upgraded on a
+// successful login.
+func NewPasswordLoginBlueprint(path string, config PasswordLoginConfiguration) *Blueprint {
+	if config.Users == nil {
+		panic("mcgoweb: password login configuration requires a user store")
+	}
+	if config.Hasher == nil {
+		config.Hasher = DefaultPasswordHasher
+	}
+	if config.SuccessPath == "" {
+		config.SuccessPath = "/"
+	}
+	if config.LogoutPath == "" {
+		config.LogoutPath = "login"
+	}
+	if config.MinPasswordLength == 0 {
+		config.MinPasswordLength = 8
+	}
+	if config.TOTPIssuer == "" {
+		config.TOTPIssuer = "mcgoweb"
+	}
+	login := &passwordLogin{config: config}
+
+	blueprint := NewBlueprint(path)
+	blueprint.AddMiddleware(SessionMiddleware)
+
+	login_handler := NewHandler("/login", HTTP_GET|HTTP_POST)
+	login_handler.RequestHandler = login.login
+	blueprint.RegisterHandler(login_handler)
+
+	// Signing out changes state, so a link or image on another
+	// site must not be able to do it.
+	logout_handler := NewHandler("/logout", HTTP_POST)
+	logout_handler.RequestHandler = login.logout
+	blueprint.RegisterHandler(logout_handler)
+
+	password_handler := NewHandler("/password", HTTP_GET|HTTP_POST)
+	password_handler.RequestHandler = login.changePassword
+	blueprint.RegisterHandler(password_handler)
+
+	totp_handler := NewHandler("/totp", HTTP_GET|HTTP_POST)
+	totp_handler.RequestHandler = login.secondFactor
+	blueprint.RegisterHandler(totp_handler)
+
+	enroll_handler := NewHandler("/totp/enroll", HTTP_GET|HTTP_POST)
+	enroll_handler.RequestHandler = login.enrollSecondFactor
+	blueprint.RegisterHandler(enroll_handler)
+
+	return blueprint
+}
+
+func (login *passwordLogin) login(context *RequestContext) {
+	if context.Request.Method != "POST" {
+		login.render(context, http.StatusOK, "login", &PasswordLoginPage{})
+		return
+	}
+
+	name := context.Request.PostFormValue("username")
+	password := context.Request.PostFormValue("password")
+	page := &PasswordLoginPage{User: name}
+	if login.throttled(context, name) {
+		page.Error = "Too many failed attempts, try again later."
+		login.render(context, http.StatusTooManyRequests, "login", page)
+		return
+	}
+
+	user := login.verify(name, password)
+	if user == nil {
+		context.LoginFailed(name)
+		page.Error = "Invalid username or password."
+		login.render(context, http.StatusUnauthorized, "login", page)
+		return
+	}
+	if user.TOTPSecret != "" {
+		context.StartSecondFactorSession(name)
+		http.Redirect(context.Writer, context.Request, "totp", http.StatusSeeOther)
+		return
+	}
+	context.StartSession(name)
+	http.Redirect(context.Writer, context.Request, login.config.SuccessPath, http.StatusSeeOther)
+}
+
+// verify returns the named user if the password is correct,
+// upgrading the stored hash if needed.
+func (login *passwordLogin) verify(name, password string) *User {
+	hasher := login.config.Hasher
+	user, err := login.config.Users.GetUser(name)
+	if err != nil {
+		// Hash anyway so unknown users can not be discovered
+		// by timing the response.
+		hasher.Verify(password, login.dummyHash())
+		return nil
+	}
+	if ok, err := hasher.Verify(password, user.PasswordHash); !ok || err != nil {
+		return nil
+	}
+	if hasher.NeedsUpgrade(user.PasswordHash) {
+		if err := user.SetPassword(password, hasher); err == nil {
+			if err := login.config.Users.PutUser(user); err != nil {
+				log.Println("Failed to upgrade password hash:", err)
+			}
+		}
+	}
+	return user
+}
+
+// throttled sets the Retry-After header and returns true if login
+// attempts for the user are currently throttled.
+func (login *passwordLogin) throttled(context *RequestContext, name string) bool {
+	if err, ok := context.CheckLogin(name).(*LoginThrottledError); ok {
+		context.Writer.Header().Set("Retry-After", formatDeltaSeconds(err.RetryAfter))
+		return true
+	}
+	return false
+}
+
+func (login *passwordLogin) logout(context *RequestContext) {
+	context.EndSession()
+	http.Redirect(context.Writer, context.Request, login.config.LogoutPath, http.StatusSeeOther)
+}
+
+func (login *passwordLogin) changePassword(context *RequestContext) {
+	var name string
+	if context.Session != nil {
+		name, _ = context.Session.GetValue("user")
+	}
+	if name == "" {
+		http.Redirect(context.Writer, context.Request, "login", http.StatusSeeOther)
+		return
+	}
+	if context.Request.Method != "POST" {
+		login.render(context, http.StatusOK, "change_password", &PasswordLoginPage{User: name})
+		return
+	}
+
+	page := &PasswordLoginPage{User: name}
+	if login.throttled(context, name) {
+		page.Error = "Too many failed attempts, try again later."
+		login.render(context, http.StatusTooManyRequests, "change_password", page)
+		return
+	}
+
+	current := context.Request.PostFormValue("current_password")
+	password := context.Request.PostFormValue("new_password")
+	if login.verify(name, current) == nil {
+		context.LoginFailed(name)
+		page.Error = "Current password is incorrect."
+		login.render(context, http.StatusForbidden, "change_password", page)
+		return
+	}
+	if len(password) < login.config.MinPasswordLength {
+		context.ReleaseLogin(name)
+		page.Error = "New password is too short."
+		login.render(context, http.StatusBadRequest, "change_password", page)
+		return
+	}
+	if password != context.Request.PostFormValue("confirm_password") {
+		context.ReleaseLogin(name)
+		page.Error = "New passwords do not match."
+		login.render(context, http.StatusBadRequest, "change_password", page)
+		return
+	}
+
+	user, err := login.config.Users.GetUser(name)
+	if err == nil {
+		err = user.SetPassword(password, login.config.Hasher)
+	}
+	if err == nil {
+		err = login.config.Users.PutUser(user)
+	}
+	if err != nil {
+		context.ReleaseLogin(name)
+		log.Println("Failed to change password:", err)
+		http.Error(context.Writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// Replace the session so any other copy of the old session
+	// key can not be used with the new password.
+	context.StartSession(name)
+	page.Message = "Password changed."
+	login.render(context, http.StatusOK, "change_password", page)
+}
+
+func (login *passwordLogin) secondFactor(context *RequestContext) {
+	name, ok := context.Session.PendingSecondFactor()
+	if !ok {
+		http.Redirect(context.Writer, context.Request, "login", http.StatusSeeOther)
+		return
+	}
+	page := &PasswordLoginPage{User: name}
+	if context.Request.Method != "POST" {
+		login.render(context, http.StatusOK, "totp", page)
+		return
+	}
+	if login.throttled(context, name) {
+		page.Error = "Too many failed attempts, try again later."
+		login.render(context, http.StatusTooManyRequests, "totp", page)
+		return
+	}
+
+	user, err := login.config.Users.GetUser(name)
+	if err != nil {
+		context.ReleaseLogin(name)
+		context.EndSession()
+		http.Redirect(context.Writer, context.Request, "login", http.StatusSeeOther)
+		return
+	}
+	if !user.VerifySecondFactor(context.Request.PostFormValue("code"), time.Now()) {
+		context.LoginFailed(name)
+		page.Error = "Invalid authentication code."
+		login.render(context, http.StatusUnauthorized, "totp", page)
+		return
+	}
+	// The code must not be usable again.
+	if err := login.config.Users.PutUser(user); err != nil {
+		context.ReleaseLogin(name)
+		log.Println("Failed to store used second factor:", err)
+		http.Error(context.Writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	context.CompleteSecondFactor()
+	http.Redirect(context.Writer, context.Request, login.config.SuccessPath, http.StatusSeeOther)
+}
+
+func (login *passwordLogin) enrollSecondFactor(context *RequestContext) {
+	var name string
+	if context.Session != nil {
+		name, _ = context.Session.GetValue("user")
+	}
+	if name == "" {
+		http.Redirect(context.Writer, context.Request, "../login", http.StatusSeeOther)
+		return
+	}
+	page := &PasswordLoginPage{User: name}
+
+	if context.Request.Method != "POST" {
+		enrollment, err := NewTOTPEnrollment(login.config.TOTPIssuer, name)
+		if err != nil {
+			http.Error(context.Writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		// The enrollment is only kept in the session until it
+		// is confirmed with a valid code.
+		context.Session.UpdateValue(totpEnrollmentSecretKey, enrollment.Secret)
+		context.Session.UpdateValue(totpEnrollmentCodesKey, strings.Join(enrollment.RecoveryCodes, " "))
+		page.TOTP = enrollment
+		login.render(context, http.StatusOK, "totp_enroll", page)
+		return
+	}
+
+	secret, _ := context.Session.GetValue(totpEnrollmentSecretKey)
+	codes, _ := context.Session.GetValue(totpEnrollmentCodesKey)
+	if secret == "" {
+		http.Redirect(context.Writer, context.Request, "enroll", http.StatusSeeOther)
+		return
+	}
+	enrollment := &TOTPEnrollment{
+		Secret:        secret,
+		URI:           TOTPURI(login.config.TOTPIssuer, name, secret),
+		RecoveryCodes: strings.Fields(codes),
+	}
+	step, ok := VerifyTOTPStep(secret, strings.TrimSpace(context.Request.PostFormValue("code")), time.Now())
+	if !ok {
+		page.TOTP = enrollment
+		page.Error = "Invalid authentication code."
+		login.render(context, http.StatusBadRequest, "totp_enroll", page)
+		return
+	}
+
+	user, err := login.config.Users.GetUser(name)
+	if err == nil {
+		user.EnableTOTP(enrollment)
+		// The confirmation code must not be usable to log in.
+		user.TOTPLastStep = step
+		err = login.config.Users.PutUser(user)
+	}
+	if err != nil {
+		log.Println("Failed to enable two-factor authentication:", err)
+		http.Error(context.Writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	context.Session.UpdateValue(totpEnrollmentSecretKey, "")
+	context.Session.UpdateValue(totpEnrollmentCodesKey, "")
+	page.Message = "Two-factor authentication enabled."
+	login.render(context, http.StatusOK, "totp_enroll", page)
+}
+
+func (login *passwordLogin) render(context *RequestContext, status int, name string, page *PasswordLoginPage) {
+	templates := defaultPasswordLoginTemplates
+	if login.config.Templates != nil && login.config.Templates.Lookup(name) != nil {
+		templates = login.config.Templates
+	}
+	if err := context.renderTemplate(templates, name, status, page); err != nil {
+		log.Println("Failed to render template:", err)
+		http.Error(context.Writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+func (login *passwordLogin) dummyHash() string {
+	login.dummy_once.Do(func() {
+		login.dummy_hash, _ = login.config.Hasher.Hash("")
+	})
+	return login.dummy_hash
+}
@@ -0,0 +1,98 @@
+package mcgoweb
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestPasswordLoginBlueprint(t *testing.T) {
+	hasher := &PasswordHasher{Iterations: 20, SaltLength: 16, KeyLength: 32}
+	users := NewMemoryUserStore()
+	admin := &User{Name: "admin"}
+	admin.SetPassword("old password", &PasswordHasher{Iterations: 10, SaltLength: 16, KeyLength: 32})
+	users.PutUser(admin)
+
+	cache := NewMemorySessionCache()
+	app := NewHTTPApplication("Password Login Test", "/", "0.0.0.0:7654")
+	app.SetSessionCache(cache)
+	if _, err := app.RegisterBlueprint(NewPasswordLoginBlueprint("/auth", PasswordLoginConfiguration{
+		Users:       users,
+		Hasher:      hasher,
+		SuccessPath: "/console",
+	})); err != nil {
+		t.Fatalf("Unexpected error registering blueprint: %s", err)
+	}
+
+	post := func(path string, form url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+		request := createTestRequest(path)
+		request.Method = "POST"
+		request.Header = make(http.Header)
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Body = ioutil.NopCloser(strings.NewReader(form.Encode()))
+		if cookie != nil {
+			request.AddCookie(cookie)
+		}
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		return response
+	}
+
+	response := post("/auth/login", url.Values{"username": {"admin"}, "password": {"wrong"}}, nil)
+	if response.Code != 401 {
+		t.Errorf("Unexpected response code %d, expected 401", response.Code)
+	}
+	if !strings.Contains(response.Body.String(), "Invalid username or password") {
+		t.Errorf("Missing login error in response body:\n%s", response.Body.String())
+	}
+
+	response = post("/auth/login", url.Values{"username": {"admin"}, "password": {"old password"}}, nil)
+	if response.Code != 303 {
+		t.Fatalf("Unexpected response code %d, expected 303", response.Code)
+	}
+	cookies := response.Result().Cookies()
+	if len(cookies) != 1 || GetSession(cookies[0].Value, cache) == nil {
+		t.Fatalf("Missing session after login")
+	}
+	if user, _ := users.GetUser("admin"); hasher.NeedsUpgrade(user.PasswordHash) {
+		t.Errorf("Password hash not upgraded on login")
+	}
+
+	response = post("/auth/password", url.Values{
+		"current_password": {"old password"},
+		"new_password":     {"new password"},
+		"confirm_password": {"new password"},
+	}, cookies[0])
+	if response.Code != 200 {
+		t.Fatalf("Unexpected response code %d, expected 200", response.Code)
+	}
+	if GetSession(cookies[0].Value, cache) != nil {
+		t.Errorf("Session not replaced after password change")
+	}
+	if user, _ := users.GetUser("admin"); !verifyPassword(hasher, "new password", user.PasswordHash) {
+		t.Errorf("Password not changed")
+	}
+
+	session_cookie := response.Result().Cookies()[0]
+	request := createTestRequest("/auth/logout")
+	request.Header = make(http.Header)
+	request.AddCookie(session_cookie)
+	response = httptest.NewRecorder()
+	app.ServeHTTP(response, request)
+	if response.Code == 303 || GetSession(session_cookie.Value, cache) == nil {
+		t.Errorf("Unexpected logout for GET request")
+	}
+
+	response = post("/auth/logout", url.Values{}, session_cookie)
+	if expected := "/auth/login"; response.Header().Get("Location") != expected {
+		t.Errorf("Unexpected logout redirect...\nExpected: '%s'\nActual: '%s'", expected, response.Header().Get("Location"))
+	}
+}
+
+func verifyPassword(hasher *PasswordHasher, password, hash string) bool {
+	ok, _ := hasher.Verify(password, hash)
+	return ok
+}
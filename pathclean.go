@@ -0,0 +1,89 @@
+package mcgoweb
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// TrailingSlashStrict and TrailingSlashRedirect are the trailing
+// slash modes of an application.  In the strict mode, the default,
+// "/users" and "/users/" are different paths.  In the redirect mode
+// a request with no matching route is redirected when toggling its
+// trailing slash would match one.
+const (
+	TrailingSlashStrict   = "strict"
+	TrailingSlashRedirect = "redirect"
+)
+
+// canonicalPath returns the escaped path of the URL with each
+// segment escaped the same way as the literal text of patterns,
+// keeping escaped slashes within segments.
+func canonicalPath(request_url *url.URL) string {
+	if request_url.RawPath == "" {
+		return request_url.EscapedPath()
+	}
+	segments := strings.Split(request_url.EscapedPath(), "/")
+	for i, segment := range segments {
+		if decoded, err := url.PathUnescape(segment); err == nil {
+			segments[i] = escapeSegment(decoded)
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// escapeSegment escapes a path segment, including any slashes.
+func escapeSegment(segment string) string {
+	return strings.ReplaceAll(escapePath(segment), "/", "%2F")
+}
+
+// cleanPath returns the path with repeated slashes and dot segments
+// removed, keeping any trailing slash.
+func cleanPath(request_path string) string {
+	cleaned := path.Clean("/" + request_path)
+	if strings.HasSuffix(request_path, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// toggleTrailingSlash adds or removes the trailing slash of a path.
+func toggleTrailingSlash(request_path string) string {
+	if request_path == "/" {
+		return request_path
+	}
+	if strings.HasSuffix(request_path, "/") {
+		return strings.TrimSuffix(request_path, "/")
+	}
+	return request_path + "/"
+}
+
+// matchPath returns the canonical path routes are matched against.
+func (context *RequestContext) matchPath() string {
+	if context.routingPath == "" {
+		return canonicalPath(context.Request.URL)
+	}
+	return context.routingPath
+}
+
+// redirectStatus returns the status for permanently redirecting a
+// request.  Requests other than GET and HEAD are redirected with
+// 308 so their method and body are kept.
+func redirectStatus(method string) int {
+	if method == "GET" || method == "HEAD" {
+		return http.StatusMovedPermanently
+	}
+	return http.StatusPermanentRedirect
+}
+
+// redirectLocation returns the escaped path with the request's query.
+// Leading slashes are collapsed so the location can not be read as
+// a scheme relative URL for another host, such as "//example.com/".
+func redirectLocation(request *http.Request, escaped_path string) string {
+	escaped_path = "/" + strings.TrimLeft(escaped_path, "/")
+	if request.URL.RawQuery != "" {
+		return escaped_path + "?" + request.URL.RawQuery
+	}
+	return escaped_path
+}
@@ -0,0 +1,87 @@
+package mcgoweb
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPathCleaning(t *testing.T) {
+	var vars map[string]string
+	NewTestApplication := func(configuration HTTPApplicationConfiguration) *HTTPApplication {
+		app := NewHTTPApplicationFromConfiguration(configuration)
+		for _, handler_path := range []string{"/user/<userid:int>", "/files/<name:string>", "/tree/<rest:path>", "/list/", "/a b"} {
+			handler := NewHandler(handler_path, HTTP_GET|HTTP_POST)
+			handler.RequestHandler = func(context *RequestContext) {
+				vars = context.RequestVars
+				context.Writer.WriteHeader(200)
+			}
+			if _, err := app.RegisterHandler(handler); err != nil {
+				t.Fatalf("Unexpected error registering '%s': %s", handler_path, err)
+			}
+		}
+		return app
+	}
+
+	cleanTest := func(t *testing.T, app *HTTPApplication, method, request_path string, expected_code int, expected_location string) {
+		request := createTestRequest(request_path)
+		request.Method = method
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		if response.Code != expected_code || response.Header().Get("Location") != expected_location {
+			t.Errorf("Unexpected response for %s '%s'...\nExpected: %d '%s'\nActual: %d '%s'", method, request_path, expected_code, expected_location, response.Code, response.Header().Get("Location"))
+		}
+	}
+
+	configuration := NewHTTPApplicationConfiguration("Clean Test", "/", "0.0.0.0:7654")
+	strict := NewTestApplication(configuration)
+	cleanTest(t, strict, "GET", "//user/1", 404, "")
+	cleanTest(t, strict, "GET", "/user/1/", 404, "")
+	cleanTest(t, strict, "GET", "/User/1", 404, "")
+
+	vars = nil
+	cleanTest(t, strict, "GET", "/files/a%2Fb%20c", 200, "")
+	if expected := "a/b c"; vars["name"] != expected {
+		t.Errorf("Unexpected value for 'name'...\nExpected: '%s'\nActual: '%s'", expected, vars["name"])
+	}
+	cleanTest(t, strict, "GET", "/tree/a%2Fb/c", 200, "")
+	if expected := "a/b/c"; vars["rest"] != expected {
+		t.Errorf("Unexpected value for 'rest'...\nExpected: '%s'\nActual: '%s'", expected, vars["rest"])
+	}
+	cleanTest(t, strict, "GET", "/a%20b", 200, "")
+	cleanTest(t, strict, "GET", "/%61%20b", 200, "")
+
+	configuration.CleanPath = true
+	configuration.TrailingSlash = TrailingSlashRedirect
+	configuration.CaseInsensitive = true
+	clean := NewTestApplication(configuration)
+	cleanTest(t, clean, "GET", "//user/1", 301, "/user/1")
+	cleanTest(t, clean, "GET", "/x/../user/1?tab=2", 301, "/user/1?tab=2")
+	cleanTest(t, clean, "POST", "/./user/1", 308, "/user/1")
+	cleanTest(t, clean, "GET", "/user/1/", 301, "/user/1")
+	cleanTest(t, clean, "GET", "/list", 301, "/list/")
+	cleanTest(t, clean, "GET", "/files/a%2Fb/", 301, "/files/a%2Fb")
+	cleanTest(t, clean, "GET", "/missing/", 404, "")
+	cleanTest(t, clean, "GET", "/USER/1", 200, "")
+
+	// Redirects must not lead to another host
+	configuration.CleanPath = false
+	configuration.CaseInsensitive = false
+	unclean := NewHTTPApplicationFromConfiguration(configuration)
+	handler := NewHandler("/<rest:path>/", HTTP_GET)
+	handler.RequestHandler = func(context *RequestContext) {
+		context.Writer.WriteHeader(200)
+	}
+	if _, err := unclean.RegisterHandler(handler); err != nil {
+		t.Fatalf("Unexpected error registering handler: %s", err)
+	}
+	cleanTest(t, unclean, "GET", "//evil.com", 301, "/evil.com/")
+	cleanTest(t, unclean, "GET", "///evil.com?x=1", 301, "/evil.com/?x=1")
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected unknown trailing slash mode to panic")
+		}
+	}()
+	configuration.TrailingSlash = "sometimes"
+	NewHTTPApplicationFromConfiguration(configuration)
+}
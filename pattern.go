@@ -0,0 +1,451 @@
+package mcgoweb
+
+import (
+	"fmt"
+	"regexp"
+	resyntax "regexp/syntax"
+	"strings"
+	"unicode/utf8"
+)
+
+// PatternError describes an invalid route path or host pattern.
+type PatternError struct {
+	Pattern string
+	Offset  int
+	Reason  string
+}
+
+func (err *PatternError) Error() string {
+	return fmt.Sprintf("mcgoweb: invalid pattern %q at offset %d: %s", err.Pattern, err.Offset, err.Reason)
+}
+
+// patternToken represents literal text or a variable within a
+// segment of a pattern.
+type patternToken struct {
+	literal string
+	name    string
+	kind    string
+	pattern string
+	valueRE *regexp.Regexp
+	// spans is set for expressions that can match the separator
+	spans bool
+}
+
+// patternSegment represents a separator delimited segment of a
+// pattern, nested within depth optional groups.
+type patternSegment struct {
+	tokens []patternToken
+	depth  int
+}
+
+// routePattern represents a parsed pattern.  The expression is
+// unanchored and the signature is the pattern with variable names
+// removed, so equivalent patterns have equal signatures.
+type routePattern struct {
+	expression string
+	signature  string
+	segments   []patternSegment
+}
+
+var variableNameRE = regexp.MustCompile("^[a-zA-Z_]\\w*$")
+
+// patternSyntax describes the segments of a kind of pattern.
+type patternSyntax struct {
+	separator byte
+	types     map[string]string
+	escape    func(string) string
+	optional  bool
+}
+
+var pathSyntax = patternSyntax{
+	separator: '/',
+	types: map[string]string{
+		"int":    "[\\d]+",
+		"path":   ".+?",
+		"string": "[^/]+",
+	},
+	escape:   escapeSegment,
+	optional: true,
+}
+
+var hostSyntax = patternSyntax{
+	separator: '.',
+	types: map[string]string{
+		"int":    "[\\d]+",
+		"path":   ".+?",
+		"string": "[^.]+",
+	},
+}
+
+// parsePathPattern parses a route path.  Segments contain literal
+// text and variables written as <name:type>, where the type is int,
+// string, path, or re:<expression>, and <name> is short for
+// <name:string>.  Trailing segments may be made optional by
+// enclosing them in brackets, such as "/archive/<year:int>[/<month:int>]".
+// Patterns match the canonical escaped path, so literal text is
+// escaped and expressions see escaped values.
+func parsePathPattern(path string) (*routePattern, error) {
+	parsed, err := parsePattern(strings.TrimLeft(path, "/"), pathSyntax)
+	if err != nil {
+		err.(*PatternError).Pattern = path
+		return nil, err
+	}
+	parsed.expression = "/" + parsed.expression
+	parsed.signature = "/" + parsed.signature
+	return parsed, nil
+}
+
+// parseHostPattern parses a host made of dot separated labels.
+// Variables of the string type match a single label.  Hosts are
+// matched regardless of case, and so are variable values.
+func parseHostPattern(host string) (*routePattern, error) {
+	parsed, err := parsePattern(host, hostSyntax)
+	if err != nil {
+		return nil, err
+	}
+	for _, segment := range parsed.segments {
+		for i, token := range segment.tokens {
+			if token.valueRE != nil {
+				segment.tokens[i].valueRE = regexp.MustCompile("(?i)" + token.valueRE.String())
+			}
+		}
+	}
+	return parsed, nil
+}
+
+func parsePattern(pattern string, syntax patternSyntax) (*routePattern, error) {
+	parsed := new(routePattern)
+	var expression, signature, literal strings.Builder
+	segment := patternSegment{}
+	names := make(map[string]bool)
+	depth := 0
+	closed := false
+
+	pattern_error := func(offset int, reason string) error {
+		return &PatternError{Pattern: pattern, Offset: offset, Reason: reason}
+	}
+	flush_literal := func() {
+		if literal.Len() > 0 {
+			segment.tokens = append(segment.tokens, patternToken{literal: literal.String()})
+			if syntax.escape != nil {
+				expression.WriteString(regexp.QuoteMeta(syntax.escape(literal.String())))
+			} else {
+				expression.WriteString(regexp.QuoteMeta(literal.String()))
+			}
+			signature.WriteString(literal.String())
+			literal.Reset()
+		}
+	}
+	end_segment := func() {
+		flush_literal()
+		parsed.segments = append(parsed.segments, segment)
+		segment = patternSegment{depth: depth}
+	}
+
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		if closed && c != ']' && c != '[' {
+			return nil, pattern_error(i, "optional segments must end the pattern")
+		}
+		switch {
+		case c == '<':
+			end := variableEnd(pattern, i)
+			if end < 0 {
+				return nil, pattern_error(i, "unterminated variable")
+			}
+			token, reason := parseVariable(pattern[i+1:end], syntax.types)
+			if reason != "" {
+				return nil, pattern_error(i, reason)
+			}
+			if names[token.name] {
+				return nil, pattern_error(i, "duplicate variable "+token.name)
+			}
+			names[token.name] = true
+			token.spans = token.kind == "re" && matchesByte(token.pattern, syntax.separator)
+			flush_literal()
+			segment.tokens = append(segment.tokens, token)
+			if token.kind == "re" {
+				expression.WriteString("(?P<" + token.name + ">" + token.pattern + ")")
+				signature.WriteString("<re:" + token.pattern + ">")
+			} else {
+				expression.WriteString("(?P<" + token.name + ">" + syntax.types[token.kind] + ")")
+				signature.WriteString("<" + token.kind + ">")
+			}
+			i = end
+		case c == syntax.separator:
+			end_segment()
+			expression.WriteString(regexp.QuoteMeta(string(syntax.separator)))
+			signature.WriteByte(c)
+		case syntax.optional && c == '[':
+			if i+1 >= len(pattern) || pattern[i+1] != syntax.separator {
+				return nil, pattern_error(i, "optional segments must start with "+string(syntax.separator))
+			}
+			depth++
+			closed = false
+			expression.WriteString("(?:")
+			signature.WriteByte(c)
+		case syntax.optional && c == ']':
+			if depth == 0 {
+				return nil, pattern_error(i, "unmatched ]")
+			}
+			depth--
+			closed = true
+			flush_literal()
+			expression.WriteString(")?")
+			signature.WriteByte(c)
+		case c == '>':
+			return nil, pattern_error(i, "unmatched >")
+		default:
+			literal.WriteByte(c)
+		}
+	}
+	if depth != 0 {
+		return nil, pattern_error(len(pattern), "unterminated optional segment")
+	}
+	end_segment()
+
+	parsed.expression = expression.String()
+	parsed.signature = signature.String()
+	return parsed, nil
+}
+
+// variableEnd returns the index of the '>' closing the variable
+// starting at start, allowing for brackets within expressions.
+func variableEnd(pattern string, start int) int {
+	depth := 0
+	for i := start; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '<':
+			depth++
+		case '>':
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func parseVariable(variable string, types map[string]string) (patternToken, string) {
+	name, kind, _ := strings.Cut(variable, ":")
+	if !variableNameRE.MatchString(name) {
+		return patternToken{}, fmt.Sprintf("invalid variable name %q", name)
+	}
+	token := patternToken{name: name, kind: kind}
+	if kind == "" {
+		token.kind = "string"
+	}
+	if expression, ok := strings.CutPrefix(kind, "re:"); ok {
+		if expression == "" {
+			return patternToken{}, "empty expression for variable " + name
+		}
+		compiled, err := regexp.Compile(expression)
+		if err != nil {
+			return patternToken{}, err.Error()
+		}
+		// Named groups would be added to the request variables
+		for _, group_name := range compiled.SubexpNames() {
+			if group_name != "" {
+				return patternToken{}, "named groups are not allowed in expression for variable " + name
+			}
+		}
+		token.kind, token.pattern = "re", expression
+		token.valueRE = regexp.MustCompile("^(?:" + expression + ")$")
+		return token, ""
+	}
+	type_pattern, ok := types[token.kind]
+	if !ok {
+		return patternToken{}, fmt.Sprintf("unknown type %q for variable %s", kind, name)
+	}
+	token.valueRE = regexp.MustCompile("^(?:" + type_pattern + ")$")
+	return token, ""
+}
+
+// Specificity ranks of variable types, lower ranks are matched
+// first.  Expressions that can match the separator rank with path
+// variables, and mounted handlers are matched after any route
+// sharing their prefix.
+var variableTypeRanks = map[string]int{
+	"int":    1,
+	"re":     1,
+	"string": 2,
+	"path":   3,
+	"mount":  4,
+}
+
+// rank returns the specificity of the segment, literal segments
+// being the most specific and segments mixing literal text with
+// variables being more specific than the variables alone.
+func (segment patternSegment) rank() int {
+	rank, literal := 0, false
+	for _, token := range segment.tokens {
+		if token.name == "" {
+			literal = true
+		} else if token_rank := token.rank(); token_rank > rank {
+			rank = token_rank
+		}
+	}
+	rank *= 2
+	if literal && rank > 0 {
+		rank--
+	}
+	return rank
+}
+
+// covers returns whether the pattern matches every value the other
+// pattern matches.  Patterns are compared segment by segment, so
+// patterns with optional segments or mounts are never covered.
+func (pattern *routePattern) covers(other *routePattern) bool {
+	if len(pattern.segments) != len(other.segments) {
+		return false
+	}
+	for i, segment := range pattern.segments {
+		other_segment := other.segments[i]
+		if segment.depth > 0 || other_segment.depth > 0 || !segment.covers(other_segment) {
+			return false
+		}
+	}
+	return true
+}
+
+// covers returns whether the segment matches every value the other
+// segment matches, either being the same or being a single variable
+// matching any value the other can.
+func (segment patternSegment) covers(other patternSegment) bool {
+	if segment.equals(other) {
+		return true
+	}
+	if len(segment.tokens) != 1 || segment.tokens[0].name == "" {
+		return false
+	}
+	variable := segment.tokens[0]
+	if other.literal() {
+		var literal strings.Builder
+		for _, token := range other.tokens {
+			literal.WriteString(token.literal)
+		}
+		return variable.kind != "mount" && variable.valueRE.MatchString(escapeSegment(literal.String()))
+	}
+	if variable.kind == "int" {
+		return len(other.tokens) == 1 && other.tokens[0].kind == "int"
+	}
+	spans, empty, ok := variable.wildcard()
+	if !ok {
+		return false
+	}
+	other_empty := true
+	for _, token := range other.tokens {
+		switch {
+		case token.kind == "mount" || token.kind == "path" && !spans || token.spans && !spans:
+			return false
+		case token.name == "" || token.kind != "re" || !token.valueRE.MatchString(""):
+			other_empty = false
+		}
+	}
+	return empty || !other_empty
+}
+
+func (segment patternSegment) equals(other patternSegment) bool {
+	if len(segment.tokens) != len(other.tokens) {
+		return false
+	}
+	for i, token := range segment.tokens {
+		if other_token := other.tokens[i]; token.literal != other_token.literal || token.kind != other_token.kind || token.pattern != other_token.pattern {
+			return false
+		}
+	}
+	return true
+}
+
+func (segment patternSegment) literal() bool {
+	for _, token := range segment.tokens {
+		if token.name != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// wildcard returns whether the variable matches any value within a
+// segment, or any value at all when spans is set, and whether it
+// also matches the empty value.
+func (token patternToken) wildcard() (spans, empty, ok bool) {
+	switch token.kind {
+	case "string":
+		return false, false, true
+	case "path":
+		return true, false, true
+	case "re":
+	default:
+		return false, false, false
+	}
+	parsed, err := resyntax.Parse(token.pattern, resyntax.Perl)
+	if err != nil {
+		return false, false, false
+	}
+	parsed = parsed.Simplify()
+	for parsed.Op == resyntax.OpCapture {
+		parsed = parsed.Sub[0]
+	}
+	if parsed.Op != resyntax.OpStar && parsed.Op != resyntax.OpPlus {
+		return false, false, false
+	}
+	empty = parsed.Op == resyntax.OpStar
+	switch repeated := parsed.Sub[0]; repeated.Op {
+	case resyntax.OpAnyChar, resyntax.OpAnyCharNotNL:
+		return true, empty, true
+	case resyntax.OpCharClass:
+		// Only a class of anything but the separator
+		ranges := repeated.Rune
+		if len(ranges) == 4 && ranges[0] == 0 && ranges[1] == '/'-1 && ranges[2] == '/'+1 && ranges[3] == utf8.MaxRune {
+			return false, empty, true
+		}
+	}
+	return false, false, false
+}
+
+func (token patternToken) rank() int {
+	if token.spans {
+		return variableTypeRanks["path"]
+	}
+	return variableTypeRanks[token.kind]
+}
+
+// matchesByte returns whether the expression can match text
+// containing the byte.
+func matchesByte(expression string, c byte) bool {
+	parsed, err := resyntax.Parse(expression, resyntax.Perl)
+	if err != nil {
+		return true
+	}
+	return regexpMatchesRune(parsed, rune(c))
+}
+
+func regexpMatchesRune(parsed *resyntax.Regexp, r rune) bool {
+	switch parsed.Op {
+	case resyntax.OpAnyChar:
+		return true
+	case resyntax.OpAnyCharNotNL:
+		return r != '\n'
+	case resyntax.OpLiteral:
+		for _, literal := range parsed.Rune {
+			if literal == r {
+				return true
+			}
+		}
+	case resyntax.OpCharClass:
+		for i := 0; i+1 < len(parsed.Rune); i += 2 {
+			if parsed.Rune[i] <= r && r <= parsed.Rune[i+1] {
+				return true
+			}
+		}
+	}
+	for _, sub := range parsed.Sub {
+		if regexpMatchesRune(sub, r) {
+			return true
+		}
+	}
+	return false
+}
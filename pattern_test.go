@@ -0,0 +1,95 @@
+package mcgoweb
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPatternSyntax(t *testing.T) {
+	pathPatternTest := func(t *testing.T, path, expected string) {
+		if actual, err := getPathPattern(path); err != nil {
+			t.Errorf("Path Pattern error for '%s': %s", path, err)
+		} else if actual != expected {
+			t.Errorf("Path Pattern failure...\nExpected: '%s'\nActual:   '%s'", expected, actual)
+		}
+	}
+
+	pathPatternTest(t, "/files/a.b+c", "^/files/a\\.b\\+c$")
+	pathPatternTest(t, "/<n>", "^/(?P<n>[^/]+)$")
+	pathPatternTest(t, "/file-<n:int>.json", "^/file-(?P<n>[\\d]+)\\.json$")
+	pathPatternTest(t, "/<id:re:[a-f0-9]{8}>", "^/(?P<id>[a-f0-9]{8})$")
+	pathPatternTest(t, "/<id:re:a|b>/x", "^/(?P<id>a|b)/x$")
+	pathPatternTest(t, "/archive/<year:int>[/<month:int>[/<day:int>]]", "^/archive/(?P<year>[\\d]+)(?:/(?P<month>[\\d]+)(?:/(?P<day>[\\d]+))?)?$")
+
+	patternErrorTest := func(t *testing.T, path string) {
+		if actual, err := getPathPattern(path); err == nil {
+			t.Errorf("Expected error for pattern '%s', returned '%s'", path, actual)
+		} else if _, ok := err.(*PatternError); !ok {
+			t.Errorf("Unexpected error type %T for pattern '%s'", err, path)
+		}
+	}
+	patternErrorTest(t, "/<id:int")
+	patternErrorTest(t, "/<1d:int>")
+	patternErrorTest(t, "/<id:float>")
+	patternErrorTest(t, "/<id:re:[a-f>")
+	patternErrorTest(t, "/<id:re:>")
+	patternErrorTest(t, "/<a:re:(?P<b>x)>/<b:int>")
+	patternErrorTest(t, "/<id:int>/<id:int>")
+	patternErrorTest(t, "/a[/b")
+	patternErrorTest(t, "/a]")
+	patternErrorTest(t, "/a[b]")
+	patternErrorTest(t, "/a[/b]/c")
+
+	app := NewHTTPApplication("Pattern Test", "/", "0.0.0.0:7654")
+	if _, err := app.RegisterHandler(NewHandler("/<id:int", HTTP_GET)); err == nil {
+		t.Errorf("Expected error registering invalid pattern")
+	}
+}
+
+func TestPatternMatch(t *testing.T) {
+	var vars map[string]string
+	var matched string
+	app := NewHTTPApplication("Pattern Test", "/", "0.0.0.0:7654")
+	for _, handler_path := range []string{"/files/a.b", "/doc/<id:re:[a-f0-9]{8}>", "/export/file-<n:int>.json", "/archive/<year:int>[/<month:int>]"} {
+		handler := NewHandler(handler_path, HTTP_GET)
+		handler.Name = handler_path
+		handler.RequestHandler = func(context *RequestContext) {
+			matched, vars = context.route.Path, context.RequestVars
+		}
+		if _, err := app.RegisterHandler(handler); err != nil {
+			t.Fatalf("Unexpected error registering '%s': %s", handler_path, err)
+		}
+	}
+
+	patternMatchTest := func(t *testing.T, request_path, expected string, expected_vars map[string]string) {
+		matched, vars = "", nil
+		app.ServeHTTP(httptest.NewRecorder(), createTestRequest(request_path))
+		if matched != expected {
+			t.Errorf("Pattern match failure for '%s'...\nExpected: '%s'\nActual:   '%s'", request_path, expected, matched)
+		}
+		for name, value := range expected_vars {
+			if vars[name] != value {
+				t.Errorf("Unexpected value for '%s' matching '%s': '%s'", name, request_path, vars[name])
+			}
+		}
+	}
+	patternMatchTest(t, "/files/a.b", "/files/a.b", nil)
+	patternMatchTest(t, "/files/axb", "", nil)
+	patternMatchTest(t, "/doc/0123abcd", "/doc/<id:re:[a-f0-9]{8}>", map[string]string{"id": "0123abcd"})
+	patternMatchTest(t, "/doc/0123abcx", "", nil)
+	patternMatchTest(t, "/export/file-12.json", "/export/file-<n:int>.json", map[string]string{"n": "12"})
+	patternMatchTest(t, "/archive/2024", "/archive/<year:int>[/<month:int>]", map[string]string{"year": "2024", "month": ""})
+	patternMatchTest(t, "/archive/2024/05", "/archive/<year:int>[/<month:int>]", map[string]string{"year": "2024", "month": "05"})
+
+	urlForTest := func(t *testing.T, name string, vars map[string]string, expected string) {
+		if actual, err := app.URLFor(name, vars, nil); err != nil || actual != expected {
+			t.Errorf("URLFor failure for '%s'...\nExpected: '%s'\nActual:   '%s' %v", name, expected, actual, err)
+		}
+	}
+	urlForTest(t, "/archive/<year:int>[/<month:int>]", map[string]string{"year": "2024"}, "/archive/2024")
+	urlForTest(t, "/archive/<year:int>[/<month:int>]", map[string]string{"year": "2024", "month": "05"}, "/archive/2024/05")
+	urlForTest(t, "/export/file-<n:int>.json", map[string]string{"n": "3"}, "/export/file-3.json")
+	if _, err := app.URLFor("/doc/<id:re:[a-f0-9]{8}>", map[string]string{"id": "xyz"}, nil); err == nil {
+		t.Errorf("Expected URLFor to reject value not matching expression")
+	}
+}
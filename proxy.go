@@ -0,0 +1,248 @@
+package mcgoweb
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type forwardedRequest struct {
+	client_ip string
+	scheme    string
+	host      string
+}
+
+// ClientIP returns the IP address of the client making the
+// request.  When the request comes through a trusted proxy the
+// address is taken from the Forwarded or X-Forwarded-For header,
+// skipping any further trusted proxies.
+func (context *RequestContext) ClientIP() string {
+	return context.getForwarded().client_ip
+}
+
+// Scheme returns the scheme, "http" or "https", used by the client
+// to make the request, taking the Forwarded or X-Forwarded-Proto
+// header into account for trusted proxies.
+func (context *RequestContext) Scheme() string {
+	return context.getForwarded().scheme
+}
+
+// Host returns the host, including any port, requested by the
+// client, taking the Forwarded or X-Forwarded-Host header into
+// account for trusted proxies.
+func (context *RequestContext) Host() string {
+	return context.getForwarded().host
+}
+
+func (context *RequestContext) getForwarded() *forwardedRequest {
+	if context.forwarded == nil {
+		context.forwarded = resolveForwarded(context.Request, context.trustedProxies)
+	}
+	return context.forwarded
+}
+
+func resolveForwarded(request *http.Request, trusted []*net.IPNet) *forwardedRequest {
+	forwarded := &forwardedRequest{
+		client_ip: remoteIP(request),
+		scheme:    "http",
+		host:      request.Host,
+	}
+	if request.TLS != nil {
+		forwarded.scheme = "https"
+	}
+	if !containsIP(trusted, forwarded.client_ip) {
+		return forwarded
+	}
+
+	// Each proxy describes the connection it received, so the hop
+	// from the first untrusted address also carries the scheme and
+	// host the client used.
+	var hops []forwardedHop
+	if values := request.Header.Values("Forwarded"); len(values) > 0 {
+		hops = parseForwarded(values)
+	} else {
+		hops = parseXForwarded(request.Header)
+	}
+	if len(hops) == 0 {
+		return forwarded
+	}
+	client := 0
+	for i := len(hops) - 1; i >= 0; i-- {
+		client = i
+		if !containsIP(trusted, hops[i].client_ip) {
+			break
+		}
+	}
+
+	hop := hops[client]
+	if net.ParseIP(hop.client_ip) != nil {
+		forwarded.client_ip = hop.client_ip
+	}
+	if hop.scheme == "http" || hop.scheme == "https" {
+		forwarded.scheme = hop.scheme
+	}
+	if hop.host != "" {
+		forwarded.host = hop.host
+	}
+	return forwarded
+}
+
+type forwardedHop struct {
+	client_ip string
+	scheme    string
+	host      string
+}
+
+// parseForwarded parses RFC 7239 Forwarded header values.
+func parseForwarded(values []string) []forwardedHop {
+	var hops []forwardedHop
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			var hop forwardedHop
+			for _, pair := range strings.Split(element, ";") {
+				name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok {
+					continue
+				}
+				value = strings.Trim(value, "\"")
+				switch strings.ToLower(name) {
+				case "for":
+					hop.client_ip = stripPort(value)
+				case "proto":
+					hop.scheme = strings.ToLower(value)
+				case "host":
+					hop.host = value
+				}
+			}
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+// parseXForwarded parses the X-Forwarded-For header.  The proto and
+// host headers are matched to addresses by position when each
+// proxy appended to them, otherwise the first value is used.
+func parseXForwarded(header http.Header) []forwardedHop {
+	addresses := splitHeaderList(header.Values("X-Forwarded-For"))
+	schemes := splitHeaderList(header.Values("X-Forwarded-Proto"))
+	hosts := splitHeaderList(header.Values("X-Forwarded-Host"))
+	if len(addresses) == 0 {
+		if len(schemes) == 0 && len(hosts) == 0 {
+			return nil
+		}
+		addresses = []string{""}
+	}
+
+	hops := make([]forwardedHop, len(addresses))
+	for i, address := range addresses {
+		hops[i].client_ip = stripPort(address)
+		hops[i].scheme = strings.ToLower(listValue(schemes, i, len(addresses)))
+		hops[i].host = listValue(hosts, i, len(addresses))
+	}
+	return hops
+}
+
+func splitHeaderList(values []string) []string {
+	var list []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+func listValue(list []string, i, count int) string {
+	if len(list) == count {
+		return list[i]
+	}
+	if len(list) > 0 {
+		return list[0]
+	}
+	return ""
+}
+
+// remoteIP returns the IP address of the peer connected to the
+// server.
+func remoteIP(request *http.Request) string {
+	return stripPort(request.RemoteAddr)
+}
+
+// stripPort removes a port and any IPv6 brackets from an address.
+func stripPort(address string) string {
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+}
+
+// parseNetworks parses a list of CIDR networks or single IP
+// addresses.
+func parseNetworks(networks []string) ([]*net.IPNet, error) {
+	parsed := make([]*net.IPNet, 0, len(networks))
+	for _, network := range networks {
+		if strings.Contains(network, "/") {
+			_, ip_net, err := net.ParseCIDR(network)
+			if err != nil {
+				return nil, err
+			}
+			parsed = append(parsed, ip_net)
+			continue
+		}
+		ip := net.ParseIP(network)
+		if ip == nil {
+			return nil, fmt.Errorf("mcgoweb: invalid IP address %q", network)
+		}
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		parsed = append(parsed, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return parsed, nil
+}
+
+func containsIP(networks []*net.IPNet, address string) bool {
+	if len(networks) == 0 {
+		return false
+	}
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewIPFilterMiddleware returns a middleware refusing requests with
+// 403 Forbidden based on the client IP.  Addresses in the deny list
+// are always refused, and when the allow list is not empty only
+// addresses in it are accepted.  Both lists contain CIDR networks
+// or single IP addresses.
+func NewIPFilterMiddleware(allow, deny []string) (Middleware, error) {
+	allowed, err := parseNetworks(allow)
+	if err != nil {
+		return nil, err
+	}
+	denied, err := parseNetworks(deny)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(handler RequestHandler, context *RequestContext) {
+		client_ip := context.ClientIP()
+		if containsIP(denied, client_ip) || (len(allowed) > 0 && !containsIP(allowed, client_ip)) {
+			http.Error(context.Writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		handler(context)
+	}, nil
+}
@@ -0,0 +1,81 @@
+package mcgoweb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestForwardedResolution(t *testing.T) {
+	trusted, _ := parseNetworks([]string{"10.0.0.0/8", "192.168.1.1"})
+	forwardedTest := func(t *testing.T, remote_addr string, header http.Header, client_ip, scheme, host string) {
+		request := createTestRequest("/")
+		request.RemoteAddr = remote_addr
+		request.Host = "internal:8080"
+		request.Header = header
+		forwarded := resolveForwarded(request, trusted)
+		if forwarded.client_ip != client_ip || forwarded.scheme != scheme || forwarded.host != host {
+			t.Errorf("Forwarded resolution failure...\nExpected: %s %s %s\nActual: %s %s %s",
+				client_ip, scheme, host, forwarded.client_ip, forwarded.scheme, forwarded.host)
+		}
+	}
+
+	spoofed := http.Header{"X-Forwarded-For": {"1.2.3.4"}, "X-Forwarded-Proto": {"https"}}
+	forwardedTest(t, "203.0.113.9:5000", spoofed, "203.0.113.9", "http", "internal:8080")
+	forwardedTest(t, "10.0.0.2:5000", spoofed, "1.2.3.4", "https", "internal:8080")
+
+	chained := http.Header{
+		"X-Forwarded-For":   {"1.2.3.4, 198.51.100.7, 10.1.1.1"},
+		"X-Forwarded-Proto": {"https"},
+		"X-Forwarded-Host":  {"console.example.com"},
+	}
+	forwardedTest(t, "192.168.1.1:5000", chained, "198.51.100.7", "https", "console.example.com")
+
+	standard := http.Header{"Forwarded": {`for="[2001:db8::1]:4711";proto=https;host=api.example.com, for=10.2.2.2;proto=http`}}
+	forwardedTest(t, "10.0.0.2:5000", standard, "2001:db8::1", "https", "api.example.com")
+}
+
+func TestIPFilterMiddleware(t *testing.T) {
+	filter, err := NewIPFilterMiddleware([]string{"10.0.0.0/8"}, []string{"10.9.9.9"})
+	if err != nil {
+		t.Fatalf("Unexpected filter error: %s", err)
+	}
+	if _, err := NewIPFilterMiddleware([]string{"10.0.0.0/33"}, nil); err == nil {
+		t.Errorf("Expected error for invalid network")
+	}
+
+	NewTestBlueprint := func() *Blueprint {
+		blueprint := NewBlueprint("/admin")
+		blueprint.AddMiddleware(filter)
+		handler := NewHandler("/", HTTP_GET)
+		handler.RequestHandler = func(context *RequestContext) {
+			context.Writer.WriteHeader(200)
+		}
+		blueprint.RegisterHandler(handler)
+		return blueprint
+	}
+
+	configuration := NewHTTPApplicationConfiguration("IP Filter Test", "/", "0.0.0.0:7654")
+	configuration.TrustedProxies = []string{"127.0.0.1"}
+	app := NewHTTPApplicationFromConfiguration(configuration)
+	if _, err := app.RegisterBlueprint(NewTestBlueprint()); err != nil {
+		t.Fatalf("Unexpected error registering blueprint: %s", err)
+	}
+
+	filterTest := func(t *testing.T, remote_addr, forwarded_for string, expected int) {
+		request := createTestRequest("/admin")
+		request.RemoteAddr = remote_addr
+		request.Header = http.Header{"X-Forwarded-For": {forwarded_for}}
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		if response.Code != expected {
+			t.Errorf("Unexpected response code %d for %s via %s, expected %d", response.Code, forwarded_for, remote_addr, expected)
+		}
+	}
+
+	filterTest(t, "10.1.2.3:5000", "", 200)
+	filterTest(t, "10.9.9.9:5000", "", 403)
+	filterTest(t, "127.0.0.1:5000", "10.1.2.3", 200)
+	filterTest(t, "127.0.0.1:5000", "203.0.113.9", 403)
+	filterTest(t, "203.0.113.9:5000", "10.1.2.3", 403)
+}
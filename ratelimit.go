@@ -0,0 +1,313 @@
+package mcgoweb
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RateLimitState represents the counters stored for a single
+// rate limited key.  The meaning of the counters is defined by
+// the RateLimitAlgorithm which updates them.
+type RateLimitState struct {
+	Count     float64
+	Previous  float64
+	Timestamp time.Time
+}
+
+// RateLimitStatus represents the outcome of a rate limit check.
+type RateLimitStatus struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// RateLimitAlgorithm decides whether a request is allowed given
+// the counters stored for its key, returning the updated counters.
+type RateLimitAlgorithm interface {
+	Take(state RateLimitState, now time.Time) (RateLimitState, RateLimitStatus)
+	// Expiration is how long unused counters must be kept before
+	// they are equivalent to a new key.
+	Expiration() time.Duration
+}
+
+// RateLimitStore provides storage of rate limit counters based
+// off a key.  Implementations must apply updates to the same key
+// atomically since requests are handled concurrently.
+type RateLimitStore interface {
+	Update(key string, expiration time.Duration, update func(RateLimitState) RateLimitState) error
+}
+
+// RateLimitKeyFunc returns the key a request is counted against.
+// An empty key exempts the request from the limit.
+type RateLimitKeyFunc func(*RequestContext) string
+
+// RateLimitPolicy represents a rate limit applied by a rate limit
+// middleware.  Policies sharing a store must have distinct names.
+type RateLimitPolicy struct {
+	Name      string
+	Algorithm RateLimitAlgorithm
+	Key       RateLimitKeyFunc
+	Store     RateLimitStore
+}
+
+// TokenBucket is a RateLimitAlgorithm allowing bursts of up to
+// Limit requests, refilling Limit tokens evenly over each Period.
+type TokenBucket struct {
+	Limit  int
+	Period time.Duration
+}
+
+// SlidingWindow is a RateLimitAlgorithm allowing at most Limit
+// requests in any Window, approximated from the counts of the
+// current and previous fixed windows.
+type SlidingWindow struct {
+	Limit  int
+	Window time.Duration
+}
+
+var rateLimitPolicyCount int64
+
+// NewRateLimitMiddleware returns a middleware enforcing the given
+// policy.  Requests over the limit are responded to with 429 Too
+// Many Requests.  All responses carry RateLimit-Limit,
+// RateLimit-Remaining and RateLimit-Reset headers.
+//
+// The policy defaults to limiting by client IP using a new
+// MemoryRateLimitStore.  A separate middleware should be created
+// for each handler or blueprint with its own limits.  A TokenBucket
+// or SlidingWindow without a positive limit and period panics.
+func NewRateLimitMiddleware(policy RateLimitPolicy) Middleware {
+	if policy.Algorithm == nil {
+		panic("mcgoweb: rate limit policy requires an algorithm")
+	}
+	switch algorithm := policy.Algorithm.(type) {
+	case TokenBucket:
+		checkRateLimit(algorithm.Limit, algorithm.Period)
+	case *TokenBucket:
+		checkRateLimit(algorithm.Limit, algorithm.Period)
+	case SlidingWindow:
+		checkRateLimit(algorithm.Limit, algorithm.Window)
+	case *SlidingWindow:
+		checkRateLimit(algorithm.Limit, algorithm.Window)
+	}
+	if policy.Key == nil {
+		policy.Key = RateLimitByIP
+	}
+	if policy.Store == nil {
+		policy.Store = NewMemoryRateLimitStore()
+	}
+	if policy.Name == "" {
+		policy.Name = "policy" + strconv.FormatInt(atomic.AddInt64(&rateLimitPolicyCount, 1), 10)
+	}
+
+	return func(handler RequestHandler, context *RequestContext) {
+		key := policy.Key(context)
+		if key == "" {
+			handler(context)
+			return
+		}
+
+		var status RateLimitStatus
+		now := time.Now()
+		err := policy.Store.Update(policy.Name+":"+key, policy.Algorithm.Expiration(), func(state RateLimitState) RateLimitState {
+			state, status = policy.Algorithm.Take(state, now)
+			return state
+		})
+		if err != nil {
+			// Fail open, an unavailable store should not take the
+			// application down with it.
+			log.Println("Rate limit store error:", err)
+			handler(context)
+			return
+		}
+
+		header := context.Writer.Header()
+		header.Set("RateLimit-Limit", strconv.Itoa(status.Limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(status.Remaining))
+		header.Set("RateLimit-Reset", formatDeltaSeconds(status.Reset))
+		if !status.Allowed {
+			header.Set("Retry-After", formatDeltaSeconds(status.RetryAfter))
+			http.Error(context.Writer, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+		handler(context)
+	}
+}
+
+func checkRateLimit(limit int, period time.Duration) {
+	if limit <= 0 || period <= 0 {
+		panic(fmt.Sprintf("mcgoweb: rate limit of %d per %s must have a positive limit and period", limit, period))
+	}
+}
+
+// RateLimitByIP limits requests by the client's IP address.
+func RateLimitByIP(context *RequestContext) string {
+	return "ip:" + context.ClientIP()
+}
+
+// RateLimitBySessionUser limits requests by the session's user,
+// falling back to the client's IP address without a session.
+// SessionMiddleware must be called before the rate limit middleware.
+func RateLimitBySessionUser(context *RequestContext) string {
+	if context.Session != nil {
+		if user, ok := context.Session.GetValue("user"); ok && user != "" {
+			return "user:" + user
+		}
+	}
+	return RateLimitByIP(context)
+}
+
+// RateLimitByAPIKey returns a key function which limits requests
+// by the API key provided in the given header.  Requests without
+// the header are limited by client IP address.
+func RateLimitByAPIKey(header string) RateLimitKeyFunc {
+	return func(context *RequestContext) string {
+		if key := context.Request.Header.Get(header); key != "" {
+			return "key:" + key
+		}
+		return RateLimitByIP(context)
+	}
+}
+
+// Take removes a token from the bucket if one is available.
+func (bucket TokenBucket) Take(state RateLimitState, now time.Time) (RateLimitState, RateLimitStatus) {
+	limit := float64(bucket.Limit)
+	rate := limit / bucket.Period.Seconds()
+
+	tokens := limit
+	if !state.Timestamp.IsZero() {
+		tokens = math.Min(limit, state.Count+now.Sub(state.Timestamp).Seconds()*rate)
+	}
+
+	status := RateLimitStatus{Limit: bucket.Limit}
+	if tokens >= 1 {
+		tokens--
+		status.Allowed = true
+	} else {
+		status.RetryAfter = secondsDuration((1 - tokens) / rate)
+	}
+	status.Remaining = int(tokens)
+	status.Reset = secondsDuration((limit - tokens) / rate)
+
+	return RateLimitState{Count: tokens, Timestamp: now}, status
+}
+
+// Expiration returns the time for an empty bucket to refill.
+func (bucket TokenBucket) Expiration() time.Duration {
+	return bucket.Period
+}
+
+// Take counts the request in the current window if the weighted
+// count over the sliding window is under the limit.
+func (window SlidingWindow) Take(state RateLimitState, now time.Time) (RateLimitState, RateLimitStatus) {
+	start := now.Truncate(window.Window)
+	if !state.Timestamp.Equal(start) {
+		if start.Sub(state.Timestamp) == window.Window {
+			state.Previous = state.Count
+		} else {
+			state.Previous = 0
+		}
+		state.Count = 0
+		state.Timestamp = start
+	}
+
+	limit := float64(window.Limit)
+	elapsed := now.Sub(start)
+	weight := 1 - elapsed.Seconds()/window.Window.Seconds()
+	estimate := state.Previous*weight + state.Count
+
+	status := RateLimitStatus{Limit: window.Limit, Reset: window.Window - elapsed}
+	if estimate+1 <= limit {
+		state.Count++
+		estimate++
+		status.Allowed = true
+	} else if state.Count+1 > limit {
+		// The count becomes the previous window's, so wait into
+		// the next window until its weight drops enough for one
+		// more request.
+		status.RetryAfter = window.Window - elapsed
+		if limit >= 1 {
+			required := 1 - (limit-1)/state.Count
+			status.RetryAfter += time.Duration(math.Ceil(required * float64(window.Window)))
+		}
+	} else {
+		// Time until the previous window's weight drops enough
+		// for one more request.
+		required := 1 - (limit-1-state.Count)/state.Previous
+		status.RetryAfter = secondsDuration(required*window.Window.Seconds()) - elapsed
+	}
+	status.Remaining = int(math.Max(0, limit-estimate))
+
+	return state, status
+}
+
+// Expiration returns twice the window, after which both window
+// counts no longer apply.
+func (window SlidingWindow) Expiration() time.Duration {
+	return 2 * window.Window
+}
+
+// MemoryRateLimitStore provides a RateLimitStore using an
+// in-memory map.  Counters are not shared between processes.
+type MemoryRateLimitStore struct {
+	mutex      sync.Mutex
+	entries    map[string]*memoryRateLimitEntry
+	last_sweep time.Time
+}
+
+type memoryRateLimitEntry struct {
+	state   RateLimitState
+	expires time.Time
+}
+
+// NewMemoryRateLimitStore returns a new empty MemoryRateLimitStore.
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	store := new(MemoryRateLimitStore)
+	store.entries = make(map[string]*memoryRateLimitEntry)
+	store.last_sweep = time.Now()
+	return store
+}
+
+// Update applies the update to the counters for the key, starting
+// from empty counters if the key is unknown or its counters have
+// expired, and keeps the result until the expiration has passed.
+// Expired counters are swept at most once a minute.
+func (store *MemoryRateLimitStore) Update(key string, expiration time.Duration, update func(RateLimitState) RateLimitState) error {
+	now := time.Now()
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if now.Sub(store.last_sweep) > time.Minute {
+		for entry_key, entry := range store.entries {
+			if now.After(entry.expires) {
+				delete(store.entries, entry_key)
+			}
+		}
+		store.last_sweep = now
+	}
+
+	entry, ok := store.entries[key]
+	if !ok || now.After(entry.expires) {
+		entry = new(memoryRateLimitEntry)
+		store.entries[key] = entry
+	}
+	entry.state = update(entry.state)
+	entry.expires = now.Add(expiration)
+	return nil
+}
+
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+func formatDeltaSeconds(duration time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(duration.Seconds())), 10)
+}
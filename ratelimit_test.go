@@ -0,0 +1,143 @@
+package mcgoweb
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	bucket := TokenBucket{Limit: 2, Period: 10 * time.Second}
+	now := time.Unix(1000, 0)
+
+	var state RateLimitState
+	var status RateLimitStatus
+	for i := 0; i < 2; i++ {
+		if state, status = bucket.Take(state, now); !status.Allowed {
+			t.Fatalf("Request %d unexpectedly limited", i+1)
+		}
+	}
+	if state, status = bucket.Take(state, now); status.Allowed {
+		t.Fatalf("Request over burst limit unexpectedly allowed")
+	}
+	if expected := 5 * time.Second; status.RetryAfter != expected {
+		t.Errorf("Unexpected retry after...\nExpected: %s\nActual: %s", expected, status.RetryAfter)
+	}
+	if state, status = bucket.Take(state, now.Add(5*time.Second)); !status.Allowed {
+		t.Errorf("Request after refill unexpectedly limited")
+	}
+	if status.Remaining != 0 {
+		t.Errorf("Unexpected remaining count %d, expected 0", status.Remaining)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	window := SlidingWindow{Limit: 4, Window: time.Minute}
+	now := time.Unix(6000, 0)
+
+	var state RateLimitState
+	var status RateLimitStatus
+	for i := 0; i < 4; i++ {
+		if state, status = window.Take(state, now.Add(time.Duration(i)*time.Second)); !status.Allowed {
+			t.Fatalf("Request %d unexpectedly limited", i+1)
+		}
+	}
+	if state, status = window.Take(state, now.Add(10*time.Second)); status.Allowed {
+		t.Fatalf("Request over window limit unexpectedly allowed")
+	}
+	// A quarter into the next window three of the four requests
+	// still count.
+	if expected := 65 * time.Second; status.RetryAfter != expected {
+		t.Errorf("Unexpected retry after...\nExpected: %s\nActual: %s", expected, status.RetryAfter)
+	}
+	if _, retried := window.Take(state, now.Add(10*time.Second+status.RetryAfter)); !retried.Allowed {
+		t.Errorf("Request retried after %s unexpectedly limited", status.RetryAfter)
+	}
+
+	// Halfway through the next window half of the previous
+	// window's requests still count.
+	next := now.Add(90 * time.Second)
+	for i := 0; i < 2; i++ {
+		if state, status = window.Take(state, next); !status.Allowed {
+			t.Fatalf("Request %d in next window unexpectedly limited", i+1)
+		}
+	}
+	if state, status = window.Take(state, next); status.Allowed {
+		t.Errorf("Request over sliding limit unexpectedly allowed")
+	}
+	if expected := 15 * time.Second; status.RetryAfter != expected {
+		t.Errorf("Unexpected retry after...\nExpected: %s\nActual: %s", expected, status.RetryAfter)
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	NewTestHandler := func() *Handler {
+		handler := NewHandler("/api", HTTP_GET)
+		handler.AddMiddleware(NewRateLimitMiddleware(RateLimitPolicy{
+			Algorithm: TokenBucket{Limit: 2, Period: time.Minute},
+			Key:       RateLimitByAPIKey("X-API-Key"),
+		}))
+		handler.RequestHandler = func(context *RequestContext) {
+			context.Writer.WriteHeader(200)
+		}
+		return handler
+	}
+
+	app := NewHTTPApplication("Rate Limit Test", "/", "0.0.0.0:7654")
+	if _, err := app.Register(NewTestHandler); err != nil {
+		t.Fatalf("Unexpected error registering handler: %s", err)
+	}
+
+	requestWithKey := func(key string) *httptest.ResponseRecorder {
+		request := createTestRequest("/api")
+		request.Header = make(map[string][]string)
+		request.Header.Set("X-API-Key", key)
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		return response
+	}
+
+	var response *httptest.ResponseRecorder
+	for i := 0; i < 2; i++ {
+		response = requestWithKey("first")
+		if response.Code != 200 {
+			t.Fatalf("Unexpected response code %d, expected 200", response.Code)
+		}
+	}
+	if expected := "2"; response.Header().Get("RateLimit-Limit") != expected {
+		t.Errorf("Unexpected RateLimit-Limit '%s', expected '%s'", response.Header().Get("RateLimit-Limit"), expected)
+	}
+	if expected := "0"; response.Header().Get("RateLimit-Remaining") != expected {
+		t.Errorf("Unexpected RateLimit-Remaining '%s', expected '%s'", response.Header().Get("RateLimit-Remaining"), expected)
+	}
+
+	response = requestWithKey("first")
+	if response.Code != 429 {
+		t.Errorf("Unexpected response code %d, expected 429", response.Code)
+	}
+	if expected := "30"; response.Header().Get("Retry-After") != expected {
+		t.Errorf("Unexpected Retry-After '%s', expected '%s'", response.Header().Get("Retry-After"), expected)
+	}
+
+	response = requestWithKey("second")
+	if response.Code != 200 {
+		t.Errorf("Unexpected response code %d for separate key, expected 200", response.Code)
+	}
+}
+
+func TestRateLimitPolicyValidation(t *testing.T) {
+	for _, algorithm := range []RateLimitAlgorithm{
+		TokenBucket{Limit: 10},
+		&TokenBucket{Period: time.Second},
+		SlidingWindow{Limit: 10},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected rate limit %+v to panic", algorithm)
+				}
+			}()
+			NewRateLimitMiddleware(RateLimitPolicy{Algorithm: algorithm})
+		}()
+	}
+}
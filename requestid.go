@@ -0,0 +1,88 @@
+package mcgoweb
+
+import (
+	stdcontext "context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// RequestIDHeader is the header carrying request IDs.
+var RequestIDHeader = "X-Request-ID"
+
+// MaxRequestIDLength is the longest request ID accepted from a
+// client.
+var MaxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// RequestIDMiddleware assigns the request an ID, accepting the ID
+// sent by the client in the X-Request-ID header or generating a
+// new one.  The ID is returned in the response's X-Request-ID
+// header, including error responses, is logged by access logs and
+// is available from the request context's RequestID and from its
+// Context with RequestIDFromContext.
+//
+// Requests which match no route are not given an ID, see
+// Middleware, so set RequestIDs in the application's configuration
+// to assign every request an ID.
+func RequestIDMiddleware(handler RequestHandler, context *RequestContext) {
+	if context.requestID == "" {
+		context.assignRequestID()
+	}
+	handler(context)
+}
+
+func (context *RequestContext) assignRequestID() {
+	request_id := context.Request.Header.Get(RequestIDHeader)
+	if !validRequestID(request_id) {
+		request_id = NewRequestID()
+	}
+	context.requestID = request_id
+	context.SetContext(stdcontext.WithValue(context.Context(), requestIDKey{}, request_id))
+	context.Writer.Header().Set(RequestIDHeader, request_id)
+}
+
+var requestIDFallback atomic.Uint64
+
+// NewRequestID returns a new random request ID.  Should the system's
+// random source fail, an ID from the time and a counter is used.
+func NewRequestID() string {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		log.Println("Failed to generate request ID:", err)
+		binary.BigEndian.PutUint64(id[:8], uint64(time.Now().UnixNano()))
+		binary.BigEndian.PutUint64(id[8:], requestIDFallback.Add(1))
+	}
+	return hex.EncodeToString(id[:])
+}
+
+// RequestID returns the ID assigned to the request by
+// RequestIDMiddleware, or an empty string.
+func (context *RequestContext) RequestID() string {
+	return context.requestID
+}
+
+// RequestIDFromContext returns the request ID carried by a context
+// derived from a request's Context, or an empty string.
+func RequestIDFromContext(ctx stdcontext.Context) string {
+	request_id, _ := ctx.Value(requestIDKey{}).(string)
+	return request_id
+}
+
+// validRequestID limits client request IDs to printable ASCII
+// so they can be safely logged and returned.
+func validRequestID(request_id string) bool {
+	if request_id == "" || len(request_id) > MaxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(request_id); i++ {
+		if request_id[i] <= ' ' || request_id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,84 @@
+package mcgoweb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var request_id, from_context string
+	app := NewHTTPApplication("Request ID Test", "/", "0.0.0.0:7654")
+	app.AddMiddleware(RequestIDMiddleware)
+	handler := NewHandler("/", HTTP_GET)
+	handler.RequestHandler = func(context *RequestContext) {
+		request_id = context.RequestID()
+		from_context = RequestIDFromContext(context.Context())
+		context.Error(http.StatusInternalServerError)
+	}
+	if _, err := app.RegisterHandler(handler); err != nil {
+		t.Fatalf("Unexpected error registering handler: %s", err)
+	}
+
+	requestIDTest := func(t *testing.T, sent string, accepted bool) {
+		request := createTestRequest("/")
+		request.Header = make(http.Header)
+		if sent != "" {
+			request.Header.Set("X-Request-ID", sent)
+		}
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		returned := response.Header().Get("X-Request-ID")
+		if returned == "" || returned != request_id || returned != from_context {
+			t.Errorf("Unexpected request ids: returned '%s', context '%s', from context '%s'", returned, request_id, from_context)
+		}
+		if accepted != (returned == sent) {
+			t.Errorf("Unexpected request id '%s' for sent request id %q", returned, sent)
+		}
+	}
+	requestIDTest(t, "", false)
+	requestIDTest(t, "client-id-1", true)
+	requestIDTest(t, "bad id\x01", false)
+	requestIDTest(t, strings.Repeat("a", MaxRequestIDLength+1), false)
+
+	configuration := NewHTTPApplicationConfiguration("Request ID Test", "/", "0.0.0.0:7654")
+	configuration.RequestIDs = true
+	app = NewHTTPApplicationFromConfiguration(configuration)
+	app.AddMiddleware(RequestIDMiddleware)
+	if _, err := app.RegisterHandler(handler); err != nil {
+		t.Fatalf("Unexpected error registering handler: %s", err)
+	}
+	requestIDTest(t, "client-id-2", true)
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, createTestRequest("/missing"))
+	if response.Code != 404 || response.Header().Get("X-Request-ID") == "" {
+		t.Errorf("Expected request ID for unmatched request, got %d '%s'", response.Code, response.Header().Get("X-Request-ID"))
+	}
+}
+
+func TestRequestContextContext(t *testing.T) {
+	var has_deadline, same_context bool
+	app := NewHTTPApplication("Context Test", "/", "0.0.0.0:7654")
+	blueprint := NewBlueprint("/slow")
+	blueprint.Deadline = time.Minute
+	handler := NewHandler("/", HTTP_GET)
+	handler.RequestHandler = func(context *RequestContext) {
+		deadline, ok := context.Context().Deadline()
+		has_deadline = ok && time.Until(deadline) <= time.Minute
+		same_context = RequestContextFromContext(context.Context()) == context
+	}
+	blueprint.RegisterHandler(handler)
+	if _, err := app.RegisterBlueprint(blueprint); err != nil {
+		t.Fatalf("Unexpected error registering blueprint: %s", err)
+	}
+
+	app.ServeHTTP(httptest.NewRecorder(), createTestRequest("/slow"))
+	if !has_deadline {
+		t.Errorf("Expected handler context to have the blueprint's deadline")
+	}
+	if !same_context {
+		t.Errorf("Expected request context to be reachable from its context")
+	}
+}
@@ -0,0 +1,161 @@
+package mcgoweb
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// ResponseWriter records the response written for a request so
+// middleware can inspect it after calling the handler.  Hooks added
+// with BeforeWrite are called once just before the header is sent
+// and may still change it.  The writer keeps the http.Flusher,
+// http.Hijacker and io.ReaderFrom behavior of the writer it wraps,
+// which http.ResponseController reaches through Unwrap.
+type ResponseWriter struct {
+	http.ResponseWriter
+
+	status       int
+	bytesWritten int64
+	written      bool
+	beforeWrite  []func(writer *ResponseWriter)
+}
+
+// NewResponseWriter returns a ResponseWriter recording the response
+// written to the writer.  A writer which is already a ResponseWriter
+// is returned unchanged.
+func NewResponseWriter(writer http.ResponseWriter) *ResponseWriter {
+	if recorder, ok := writer.(*ResponseWriter); ok {
+		return recorder
+	}
+	return &ResponseWriter{ResponseWriter: writer}
+}
+
+// Status returns the status code written, 200 if only the body was
+// written, or 0 if nothing has been written.  While before-write
+// hooks are called it returns the status about to be written.
+func (writer *ResponseWriter) Status() int {
+	return writer.status
+}
+
+// BytesWritten returns the number of body bytes written.
+func (writer *ResponseWriter) BytesWritten() int64 {
+	return writer.bytesWritten
+}
+
+// Written returns whether the header has been sent, by writing,
+// flushing or hijacking the connection.
+func (writer *ResponseWriter) Written() bool {
+	return writer.written
+}
+
+// BeforeWrite adds a hook called before the header is sent.  Hooks
+// are called in the order they were added.
+func (writer *ResponseWriter) BeforeWrite(hook func(writer *ResponseWriter)) {
+	writer.beforeWrite = append(writer.beforeWrite, hook)
+}
+
+func (writer *ResponseWriter) WriteHeader(status int) {
+	if writer.written {
+		return
+	}
+	// Informational headers may be sent ahead of the response.
+	if status >= 100 && status < 200 && status != http.StatusSwitchingProtocols {
+		writer.ResponseWriter.WriteHeader(status)
+		return
+	}
+	writer.status = status
+	writer.written = true
+	for _, hook := range writer.beforeWrite {
+		hook(writer)
+	}
+	writer.ResponseWriter.WriteHeader(writer.status)
+}
+
+func (writer *ResponseWriter) Write(data []byte) (int, error) {
+	writer.WriteHeader(http.StatusOK)
+	n, err := writer.ResponseWriter.Write(data)
+	writer.bytesWritten += int64(n)
+	return n, err
+}
+
+// ReadFrom copies the reader to the response, using the wrapped
+// writer's io.ReaderFrom when it has one.
+func (writer *ResponseWriter) ReadFrom(reader io.Reader) (int64, error) {
+	writer.WriteHeader(http.StatusOK)
+	if reader_from, ok := writer.ResponseWriter.(io.ReaderFrom); ok {
+		n, err := reader_from.ReadFrom(reader)
+		writer.bytesWritten += n
+		return n, err
+	}
+	return io.Copy(writeOnly{writer}, reader)
+}
+
+func (writer *ResponseWriter) Flush() {
+	if flusher, ok := writer.ResponseWriter.(http.Flusher); ok {
+		writer.WriteHeader(http.StatusOK)
+		flusher.Flush()
+	}
+}
+
+func (writer *ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := writer.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("mcgoweb: response writer does not support hijacking")
+	}
+	conn, buffer, err := hijacker.Hijack()
+	if err == nil {
+		writer.written = true
+	}
+	return conn, buffer, err
+}
+
+func (writer *ResponseWriter) Unwrap() http.ResponseWriter {
+	return writer.ResponseWriter
+}
+
+// writeOnly hides ReadFrom so io.Copy does not recurse into it.
+type writeOnly struct {
+	io.Writer
+}
+
+// afterRequest holds the callbacks registered with AfterRequest,
+// shared by copies of a request's context.
+type afterRequest struct {
+	lock      sync.Mutex
+	callbacks []func(context *RequestContext)
+}
+
+// AfterRequest adds a callback called once the request has been
+// handled, after every middleware has returned.  Callbacks are
+// called in the reverse of the order they were added, like deferred
+// functions, and are called even if the handler panics.
+func (context *RequestContext) AfterRequest(callback func(context *RequestContext)) {
+	if context.afterRequest == nil {
+		context.afterRequest = new(afterRequest)
+	}
+	context.afterRequest.lock.Lock()
+	context.afterRequest.callbacks = append(context.afterRequest.callbacks, callback)
+	context.afterRequest.lock.Unlock()
+}
+
+// Response returns the recorder for the response to the request.
+func (context *RequestContext) Response() *ResponseWriter {
+	return context.response
+}
+
+func (context *RequestContext) runAfterRequest() {
+	if context.afterRequest == nil {
+		return
+	}
+	context.afterRequest.lock.Lock()
+	callbacks := context.afterRequest.callbacks
+	context.afterRequest.callbacks = nil
+	context.afterRequest.lock.Unlock()
+	for i := len(callbacks) - 1; i >= 0; i-- {
+		callbacks[i](context)
+	}
+}
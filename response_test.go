@@ -0,0 +1,71 @@
+package mcgoweb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResponseWriter(t *testing.T) {
+	var status int
+	var bytes_written int64
+	var order []string
+	recording := func(handler RequestHandler, context *RequestContext) {
+		context.Response().BeforeWrite(func(writer *ResponseWriter) {
+			writer.Header().Set("X-Status", http.StatusText(writer.Status()))
+		})
+		context.AfterRequest(func(context *RequestContext) {
+			order = append(order, "first")
+		})
+		context.AfterRequest(func(context *RequestContext) {
+			order = append(order, "second")
+		})
+		handler(context)
+		status = context.Response().Status()
+		bytes_written = context.Response().BytesWritten()
+	}
+
+	app := NewHTTPApplication("Response Test", "/", "0.0.0.0:7654")
+	app.AddMiddleware(recording)
+	handler := NewHandler("/created", HTTP_GET)
+	handler.RequestHandler = func(context *RequestContext) {
+		context.Writer.WriteHeader(http.StatusCreated)
+		context.Writer.Write([]byte("created"))
+	}
+	if _, err := app.RegisterHandler(handler); err != nil {
+		t.Fatalf("Unexpected error registering handler: %s", err)
+	}
+	streaming := NewHandler("/stream", HTTP_GET)
+	streaming.RequestHandler = func(context *RequestContext) {
+		if err := http.NewResponseController(context.Writer).Flush(); err != nil {
+			t.Errorf("Unexpected error flushing: %s", err)
+		}
+		context.Writer.(*ResponseWriter).ReadFrom(strings.NewReader("streamed"))
+	}
+	if _, err := app.RegisterHandler(streaming); err != nil {
+		t.Fatalf("Unexpected error registering handler: %s", err)
+	}
+
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, createTestRequest("/created"))
+	if status != http.StatusCreated || bytes_written != 7 {
+		t.Errorf("Unexpected recorded status %d and size %d", status, bytes_written)
+	}
+	if actual := response.Header().Get("X-Status"); actual != "Created" {
+		t.Errorf("Unexpected before-write header '%s'", actual)
+	}
+	if actual := strings.Join(order, ","); actual != "second,first" {
+		t.Errorf("Unexpected after-request order '%s'", actual)
+	}
+
+	response = httptest.NewRecorder()
+	app.ServeHTTP(response, createTestRequest("/stream"))
+	if status != http.StatusOK || bytes_written != 8 || !response.Flushed {
+		t.Errorf("Unexpected streamed status %d, size %d, flushed %t", status, bytes_written, response.Flushed)
+	}
+	if actual := response.Body.String(); actual != "streamed" {
+		t.Errorf("Unexpected streamed body '%s'", actual)
+	}
+
+}
@@ -1,6 +1,7 @@
 package mcgoweb
 
 import (
+	"net/url"
 	. "regexp"
 	"strings"
 )
@@ -13,57 +14,77 @@ const HTTP_GET HTTPMethods = 0x01
 const HTTP_POST HTTPMethods = 0x02
 const HTTP_PUT HTTPMethods = 0x04
 const HTTP_DELETE HTTPMethods = 0x08
+const HTTP_HEAD HTTPMethods = 0x10
+const HTTP_PATCH HTTPMethods = 0x20
+const HTTP_OPTIONS HTTPMethods = 0x40
+const HTTP_ANY HTTPMethods = HTTP_GET | HTTP_POST | HTTP_PUT | HTTP_DELETE | HTTP_HEAD | HTTP_PATCH | HTTP_OPTIONS
 
 var HTTP_METHOD_MAP = map[string]HTTPMethods{
-	"GET":    HTTP_GET,
-	"POST":   HTTP_POST,
-	"PUT":    HTTP_PUT,
-	"DELETE": HTTP_DELETE,
+	"GET":     HTTP_GET,
+	"POST":    HTTP_POST,
+	"PUT":     HTTP_PUT,
+	"DELETE":  HTTP_DELETE,
+	"HEAD":    HTTP_HEAD,
+	"PATCH":   HTTP_PATCH,
+	"OPTIONS": HTTP_OPTIONS,
 }
 
-// Route represents a route to a request handler.
+// Route represents a route to a request handler.  A route with
+// a Host only matches requests for a matching host.
 type Route struct {
+	Name    string
 	Path    string
+	Host    string
 	Handler RequestHandler
 	Methods HTTPMethods
 
-	pathRE *Regexp
-}
+	pathRE      *Regexp
+	pathPattern *routePattern
+	hostRE      *Regexp
+	hostPattern *routePattern
+	hostPort    bool
+	namespace   string
+	mountRE     *Regexp
+	blueprint   *Blueprint
 
-var variableRE *Regexp = MustCompile("^\\<([a-zA-Z]\\w+):(int|path|string)\\>$")
+	conditions []Condition
+	consumes   []string
+	produces   []string
 
-func getPathPattern(path string) string {
-	path_parts := strings.Split(strings.TrimLeft(path, "/"), "/")
-	path_re_parts := make([]string, len(path_parts))
+	handlerName     string
+	middlewareNames []string
+}
 
-	for i, part := range path_parts {
-		if variable_match := variableRE.FindStringSubmatch(part); variable_match != nil {
-			group_name := variable_match[1]
-			var group_type string
-			switch variable_match[2] {
-			case "int":
-				group_type = "[\\d]+"
-			case "path":
-				group_type = ".+?"
-			case "string":
-				group_type = "[^/]+"
-			}
-			path_re_parts[i] = "(?P<" + group_name + ">" + group_type + ")"
-		} else {
-			path_re_parts[i] = part
-		}
+func getPathPattern(path string) (string, error) {
+	pattern, err := parsePathPattern(path)
+	if err != nil {
+		return "", err
 	}
+	return "^" + pattern.expression + "$", nil
+}
 
-	return "^/" + strings.Join(path_re_parts, "/") + "$"
+// getHostPattern returns a case insensitive pattern for a host
+// made of dot separated labels.
+func getHostPattern(host string) (string, error) {
+	pattern, err := parseHostPattern(host)
+	if err != nil {
+		return "", err
+	}
+	return "(?i)^" + pattern.expression + "$", nil
 }
 
-func newRoute(path string, handler RequestHandler, methods HTTPMethods) *Route {
+func newRoute(path string, handler RequestHandler, methods HTTPMethods) (*Route, error) {
+	pattern, err := parsePathPattern(path)
+	if err != nil {
+		return nil, err
+	}
 	route := new(Route)
-	route.pathRE = MustCompile(getPathPattern(path))
+	route.pathRE = MustCompile("^" + pattern.expression + "$")
+	route.pathPattern = pattern
 	route.Path = path
 	route.Handler = handler
 	route.Methods = methods
-	return route
+	return route, nil
 }
 
 func getHTTPMethods(method string) HTTPMethods {
@@ -75,24 +96,174 @@ func getHTTPMethods(method string) HTTPMethods {
 
 }
 
+// setHost restricts the route to hosts matching the pattern.
+func (route *Route) setHost(host string) error {
+	pattern, err := parseHostPattern(host)
+	if err != nil {
+		return err
+	}
+	route.Host = host
+	route.hostRE = MustCompile("(?i)^" + pattern.expression + "$")
+	route.hostPattern = pattern
+	// Any port follows the last variable
+	route.hostPort = strings.Contains(host[strings.LastIndex(host, ">")+1:], ":")
+	return nil
+}
+
 func (route *Route) matchesRequest(context *RequestContext) bool {
 	if getHTTPMethods(context.Request.Method)&route.Methods == HTTP_METHOD_ERROR {
 		return false
 	}
-	if variable_match := route.pathRE.FindStringSubmatch(context.Request.URL.Path); variable_match != nil {
-		if len(variable_match) > 1 {
-			group_matches := variable_match[1:]
-			group_names := route.pathRE.SubexpNames()[1:]
-			context.RequestVars = make(map[string]string, len(group_matches))
-			for i, match := range group_matches {
-				context.RequestVars[group_names[i]] = match
+	host_match, ok := route.matchHost(context)
+	if !ok {
+		return false
+	}
+	if variable_match := route.pathRE.FindStringSubmatch(context.matchPath()); variable_match != nil {
+		if len(variable_match) > 1 || len(host_match) > 1 {
+			context.RequestVars = make(map[string]string, len(variable_match)+len(host_match))
+			addRequestVars(context.RequestVars, route.hostRE, host_match)
+			// Path variables are matched escaped
+			for i, value := range variable_match[1:] {
+				if decoded, err := url.PathUnescape(value); err == nil {
+					variable_match[i+1] = decoded
+				}
 			}
+			addRequestVars(context.RequestVars, route.pathRE, variable_match)
 		}
 		return true
 	}
 	return false
 }
 
+// matchHost returns whether the request's host matches the route
+// along with the host variables.
+func (route *Route) matchHost(context *RequestContext) ([]string, bool) {
+	if route.hostRE == nil {
+		return nil, true
+	}
+	host := context.Host()
+	if !route.hostPort {
+		host = stripPort(host)
+	}
+	host_match := route.hostRE.FindStringSubmatch(host)
+	return host_match, host_match != nil
+}
+
+func addRequestVars(vars map[string]string, re *Regexp, match []string) {
+	if len(match) > 1 {
+		group_names := re.SubexpNames()
+		for i, value := range match[1:] {
+			if group_names[i+1] != "" {
+				vars[group_names[i+1]] = value
+			}
+		}
+	}
+}
+
+// setCaseInsensitive makes the route's path match regardless of case.
+func (route *Route) setCaseInsensitive() {
+	route.pathRE = MustCompile("(?i)" + route.pathRE.String())
+	if route.mountRE != nil {
+		route.mountRE = MustCompile("(?i)" + route.mountRE.String())
+	}
+}
+
+// setMount makes the route match its path and any path below it,
+// the remainder being passed on to a mounted http.Handler.
+func (route *Route) setMount() error {
+	pattern := &routePattern{signature: "/"}
+	if prefix := strings.TrimRight(route.Path, "/"); prefix != "" {
+		var err error
+		if pattern, err = parsePathPattern(prefix); err != nil {
+			return err
+		}
+	}
+	route.pathPattern = &routePattern{
+		expression: pattern.expression,
+		signature:  strings.TrimSuffix(pattern.signature, "/") + "/<mount>",
+		segments:   append(pattern.segments[:len(pattern.segments):len(pattern.segments)], patternSegment{tokens: []patternToken{{name: "*", kind: "mount"}}}),
+	}
+	route.mountRE = MustCompile("^" + pattern.expression)
+	route.pathRE = MustCompile("^" + pattern.expression + "(?:/.*)?$")
+	return nil
+}
+
+// precedes returns whether the route should be matched before the
+// other route.  Routes with a host come first, then routes are
+// compared part by part: literal text before int variables before
+// string variables before path variables.  When all compared parts
+// rank equally the longer route comes first, and remaining ties
+// are broken by the literal text and conditions so the order does
+// not depend on registration order.
+func (route *Route) precedes(other *Route) bool {
+	if (route.hostRE != nil) != (other.hostRE != nil) {
+		return route.hostRE != nil
+	}
+	segments, other_segments := route.pathPattern.segments, other.pathPattern.segments
+	for i := 0; i < len(segments) && i < len(other_segments); i++ {
+		if rank, other_rank := segments[i].rank(), other_segments[i].rank(); rank != other_rank {
+			return rank < other_rank
+		}
+	}
+	if len(segments) != len(other_segments) {
+		return len(segments) > len(other_segments)
+	}
+	// Equivalent routes are kept together, those with conditions
+	// falling back to those without
+	if signature, other_signature := route.signature(), other.signature(); signature != other_signature {
+		return signature < other_signature
+	}
+	if route.conditional() != other.conditional() {
+		return route.conditional()
+	}
+	if route.Host != other.Host {
+		return route.Host < other.Host
+	}
+	return route.Path < other.Path
+}
+
+// conflictsWith returns whether both routes match exactly the same
+// requests for at least one method, so one would always shadow
+// the other.  Routes with custom conditions never conflict.
+func (route *Route) conflictsWith(other *Route) bool {
+	if route.Methods&other.Methods == HTTP_METHOD_ERROR {
+		return false
+	}
+	if len(route.conditions) > 0 || len(other.conditions) > 0 {
+		return false
+	}
+	if strings.Join(route.consumes, ",") != strings.Join(other.consumes, ",") || strings.Join(route.produces, ",") != strings.Join(other.produces, ",") {
+		return false
+	}
+	return route.signature() == other.signature()
+}
+
+// shadows returns whether the route matches every request the other
+// route matches, so the other route is never reached when the route
+// is matched first.  Only unconditional routes shadow others.
+func (route *Route) shadows(other *Route) bool {
+	if other.Methods&^route.Methods != 0 || route.conditional() {
+		return false
+	}
+	if route.hostPattern != nil && (other.hostPattern == nil || strings.ToLower(route.hostPattern.signature) != strings.ToLower(other.hostPattern.signature)) {
+		return false
+	}
+	return route.pathPattern.covers(other.pathPattern)
+}
+
+func (route *Route) conditional() bool {
+	return len(route.conditions) > 0 || len(route.consumes) > 0 || len(route.produces) > 0
+}
+
+// signature returns the route's host and path with variable names
+// removed, so equivalent patterns have equal signatures.
+func (route *Route) signature() string {
+	if route.hostPattern != nil {
+		return strings.ToLower(route.hostPattern.signature) + route.pathPattern.signature
+	}
+	return route.pathPattern.signature
+}
+
 func (route *Route) methodSupported(context *RequestContext) bool {
 	if method, ok := HTTP_METHOD_MAP[context.Request.Method]; ok {
 		if method&route.Methods != 0 {
@@ -1,12 +1,15 @@
 package mcgoweb
 
 import (
+	"net/http/httptest"
 	"testing"
 )
 
 func TestPathPattern(t *testing.T) {
 	pathPatternTest := func(t *testing.T, path, expected string) {
-		if actual := getPathPattern(path); actual != expected {
+		if actual, err := getPathPattern(path); err != nil {
+			t.Errorf("Path Pattern error for '%s': %s", path, err)
+		} else if actual != expected {
 			t.Errorf("Path Pattern failure...\nExpected: '%s'\nActual:   '%s'", expected, actual)
 		}
 	}
@@ -77,3 +80,103 @@ func TestRouteMatchFail(t *testing.T) {
 	routeFailMatchTest(t, "/hello/something/", "/<testvar:string>/something")
 	routeFailMatchTest(t, "/hello/something/something", "/<testvar:string>/something")
 }
+
+func TestHostPattern(t *testing.T) {
+	actual, err := getHostPattern("<tenant:string>.admin.example.com")
+	if expected := `(?i)^(?P<tenant>[^.]+)\.admin\.example\.com$`; err != nil || actual != expected {
+		t.Errorf("Host Pattern failure...\nExpected: '%s'\nActual:   '%s' %v", expected, actual, err)
+	}
+
+	hostMatchTest := func(t *testing.T, host, route_host string, expected bool) map[string]string {
+		route, context := createTestRouteAndContext("/users/7", "/users/<id:int>")
+		route.setHost(route_host)
+		context.Request.Host = host
+		if actual := route.matchesRequest(context); actual != expected {
+			t.Errorf("Host match failure...\nRoute Host: '%s'\nRequest Host: '%s'\nExpected: %t", route_host, host, expected)
+		}
+		return context.RequestVars
+	}
+
+	vars := hostMatchTest(t, "Acme.Admin.example.com:8443", "<tenant:string>.admin.example.com", true)
+	if vars["tenant"] != "Acme" || vars["id"] != "7" {
+		t.Errorf("Unexpected request variables %v", vars)
+	}
+	hostMatchTest(t, "acme.admin.example.com", "api.example.com", false)
+	hostMatchTest(t, "a.b.admin.example.com", "<tenant:string>.admin.example.com", false)
+	hostMatchTest(t, "adminxexample.com", "admin.example.com", false)
+}
+
+func TestRoutePrecedence(t *testing.T) {
+	var matched string
+	NewTestHandler := func(path string) *Handler {
+		handler := NewHandler(path, HTTP_GET)
+		handler.RequestHandler = func(context *RequestContext) {
+			matched = path
+		}
+		return handler
+	}
+
+	app := NewHTTPApplication("Precedence Test", "/", "0.0.0.0:7654")
+	if _, err := app.RegisterHandler(NewTestHandler("/<rest:path>")); err != nil {
+		t.Fatalf("Unexpected error registering handler: %s", err)
+	}
+	if _, err := app.RegisterHandler(NewTestHandler("/user/<name:string>")); err != nil {
+		t.Fatalf("Unexpected error registering handler: %s", err)
+	}
+	if _, err := app.RegisterHandler(NewTestHandler("/user/<userid:int>")); err != nil {
+		t.Fatalf("Unexpected error registering handler: %s", err)
+	}
+	if _, err := app.RegisterHandler(NewTestHandler("/user/new")); err != nil {
+		t.Fatalf("Unexpected error registering handler: %s", err)
+	}
+	if _, err := app.RegisterHandler(NewTestHandler("/<rest:path>/edit")); err != nil {
+		t.Fatalf("Unexpected error registering handler: %s", err)
+	}
+	if _, err := app.RegisterHandler(NewTestHandler("/docs/<rest:re:.+>")); err != nil {
+		t.Fatalf("Unexpected error registering handler: %s", err)
+	}
+	if _, err := app.RegisterHandler(NewTestHandler("/docs/<name:string>")); err != nil {
+		t.Fatalf("Unexpected error registering handler: %s", err)
+	}
+
+	precedenceTest := func(t *testing.T, request_path, expected string) {
+		matched = ""
+		app.ServeHTTP(httptest.NewRecorder(), createTestRequest(request_path))
+		if matched != expected {
+			t.Errorf("Route precedence failure for '%s'...\nExpected: '%s'\nActual:   '%s'", request_path, expected, matched)
+		}
+	}
+	precedenceTest(t, "/user/new", "/user/new")
+	precedenceTest(t, "/user/17", "/user/<userid:int>")
+	precedenceTest(t, "/user/someone", "/user/<name:string>")
+	precedenceTest(t, "/user/someone/edit", "/<rest:path>/edit")
+	precedenceTest(t, "/other/page", "/<rest:path>")
+	precedenceTest(t, "/docs/readme", "/docs/<name:string>")
+	precedenceTest(t, "/docs/guide/readme", "/docs/<rest:re:.+>")
+}
+
+func TestRouteConflict(t *testing.T) {
+	conflictTest := func(t *testing.T, first, second *Handler, expected bool) {
+		app := NewHTTPApplication("Conflict Test", "/", "0.0.0.0:7654")
+		if _, err := app.RegisterHandler(first); err != nil {
+			t.Fatalf("Unexpected error registering '%s': %s", first.Path, err)
+		}
+		if _, err := app.RegisterHandler(second); (err != nil) != expected {
+			t.Errorf("Route conflict failure for '%s' and '%s'...\nExpected: %t\nActual:   %v", first.Path, second.Path, expected, err)
+		}
+	}
+	conflictTest(t, NewHandler("/user", HTTP_GET), NewHandler("/user", HTTP_GET|HTTP_POST), true)
+	conflictTest(t, NewHandler("/user/<id:int>", HTTP_GET), NewHandler("/user/<userid:int>", HTTP_GET), true)
+	conflictTest(t, NewHandler("/user", HTTP_GET), NewHandler("/user", HTTP_POST), false)
+	conflictTest(t, NewHandler("/user/<id:int>", HTTP_GET), NewHandler("/user/<name:string>", HTTP_GET), false)
+	conflictTest(t, NewHandler("/u/<x:re:[^/]+>", HTTP_GET), NewHandler("/u/<y:string>", HTTP_GET), true)
+	conflictTest(t, NewHandler("/u/<y:string>", HTTP_GET), NewHandler("/u/<x:re:[^/]+>", HTTP_GET), true)
+	conflictTest(t, NewHandler("/u/<x:re:[^/]+>/edit", HTTP_GET), NewHandler("/u/<y:re:[a-z]+>/edit", HTTP_GET), true)
+	conflictTest(t, NewHandler("/v/<x:re:.+>", HTTP_GET), NewHandler("/v/<y:path>", HTTP_GET), true)
+	conflictTest(t, NewHandler("/v/<y:path>", HTTP_GET), NewHandler("/v/<x:re:(.*)>", HTTP_GET|HTTP_POST), false)
+	conflictTest(t, NewHandler("/v/<x:re:.*>", HTTP_GET|HTTP_POST), NewHandler("/v/<y:path>", HTTP_GET), false)
+	conflictTest(t, NewHandler("/v/<x:re:.*>", HTTP_GET), NewHandler("/v/<y:re:.+>", HTTP_GET), true)
+	conflictTest(t, NewHandler("/w/<x:re:[a-z]+>", HTTP_GET), NewHandler("/w/<y:string>", HTTP_GET), false)
+	conflictTest(t, NewHandler("/w/<x:re:[a-z]+>", HTTP_GET), NewHandler("/w/new", HTTP_GET), false)
+	conflictTest(t, NewHandler("/w/<x:string>", HTTP_GET), NewHandler("/w/<y:path>", HTTP_GET), false)
+}
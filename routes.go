@@ -0,0 +1,162 @@
+package mcgoweb
+
+import (
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// RouteInfo describes a registered route.  Blueprint is the
+// namespace of the route's blueprints, or the path of an unnamed
+// blueprint.  Handler and Middleware are the names of the
+// functions, closures being named after the function which created
+// them.
+type RouteInfo struct {
+	Name       string   `json:"name,omitempty"`
+	Path       string   `json:"path"`
+	Host       string   `json:"host,omitempty"`
+	Methods    []string `json:"methods"`
+	Blueprint  string   `json:"blueprint,omitempty"`
+	Handler    string   `json:"handler"`
+	Middleware []string `json:"middleware"`
+	Consumes   []string `json:"consumes,omitempty"`
+	Produces   []string `json:"produces,omitempty"`
+	Conditions int      `json:"conditions,omitempty"`
+}
+
+// RouteCandidate describes how a route was considered for a
+// request, with the reason it was rejected or chosen.
+type RouteCandidate struct {
+	RouteInfo
+	Chosen bool   `json:"chosen"`
+	Reason string `json:"reason"`
+}
+
+// RouteExplanation describes how an application would handle a
+// request.  Status is the response status when no route is chosen
+// or the request would be redirected to Location.
+type RouteExplanation struct {
+	Method     string           `json:"method"`
+	URL        string           `json:"url"`
+	Path       string           `json:"path"`
+	Status     int              `json:"status"`
+	Location   string           `json:"location,omitempty"`
+	Route      *RouteInfo       `json:"route,omitempty"`
+	Candidates []RouteCandidate `json:"candidates"`
+}
+
+var methodNames = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+
+// Routes returns the registered routes in the order they are
+// matched.
+func (app *HTTPApplication) Routes() []RouteInfo {
+	table := app.routeTable()
+	routes := make([]RouteInfo, len(table.routes))
+	for i, route := range table.routes {
+		routes[i] = route.info()
+	}
+	return routes
+}
+
+// Explain returns how the application would route the request,
+// without calling any handler.
+func (app *HTTPApplication) Explain(request *http.Request) *RouteExplanation {
+	context := new(RequestContext)
+	context.Request = request
+	context.trustedProxies = app.trustedProxies
+	context.application = app
+
+	explanation := &RouteExplanation{Method: request.Method, URL: request.URL.String()}
+	table := app.routeTable()
+	matched, status, location := app.resolve(context, table)
+	explanation.Path = context.routingPath
+	explanation.Status = status
+	explanation.Location = location
+	if matched != nil {
+		explanation.Status = http.StatusOK
+		info := matched.info()
+		explanation.Route = &info
+	}
+
+	explanation.Candidates = make([]RouteCandidate, len(table.routes))
+	for i, route := range table.routes {
+		candidate := RouteCandidate{RouteInfo: route.info()}
+		switch {
+		case route == matched:
+			candidate.Chosen = true
+			candidate.Reason = "chosen"
+		case location != "":
+			candidate.Reason = "request redirected to " + location
+		default:
+			if candidate.Reason = route.rejection(context); candidate.Reason == "" {
+				candidate.Reason = "matched, but a more specific or more acceptable route was chosen"
+			}
+		}
+		explanation.Candidates[i] = candidate
+	}
+	return explanation
+}
+
+// rejection returns why the route does not fit the request, or an
+// empty string if it does.
+func (route *Route) rejection(context *RequestContext) string {
+	if getHTTPMethods(context.Request.Method)&route.Methods == HTTP_METHOD_ERROR {
+		return "method " + context.Request.Method + " not allowed"
+	}
+	if _, ok := route.matchHost(context); !ok {
+		return "host " + context.Host() + " does not match " + route.Host
+	}
+	if !route.pathRE.MatchString(context.matchPath()) {
+		return "path " + context.matchPath() + " does not match"
+	}
+	switch status, _ := route.checkConditions(context); status {
+	case http.StatusNotFound:
+		return "conditions not satisfied"
+	case http.StatusUnsupportedMediaType:
+		return "Content-Type " + context.Request.Header.Get("Content-Type") + " not consumed"
+	case http.StatusNotAcceptable:
+		return "no media type acceptable for Accept " + context.Request.Header.Get("Accept")
+	}
+	return ""
+}
+
+func (route *Route) info() RouteInfo {
+	info := RouteInfo{
+		Name:       route.Name,
+		Path:       route.Path,
+		Host:       route.Host,
+		Blueprint:  route.namespace,
+		Handler:    route.handlerName,
+		Middleware: route.middlewareNames,
+		Consumes:   route.consumes,
+		Produces:   route.produces,
+		Conditions: len(route.conditions),
+	}
+	for _, method := range methodNames {
+		if route.Methods&HTTP_METHOD_MAP[method] != 0 {
+			info.Methods = append(info.Methods, method)
+		}
+	}
+	if info.Blueprint == "" && route.blueprint != nil {
+		info.Blueprint = route.blueprint.Path
+	}
+	if info.Middleware == nil {
+		info.Middleware = []string{}
+	}
+	return info
+}
+
+// funcName returns the name of a function without its package path.
+func funcName(function interface{}) string {
+	value := reflect.ValueOf(function)
+	if value.Kind() != reflect.Func || value.IsNil() {
+		return ""
+	}
+	runtime_func := runtime.FuncForPC(value.Pointer())
+	if runtime_func == nil {
+		return ""
+	}
+	name := runtime_func.Name()
+	return name[strings.LastIndex(name, "/")+1:]
+}
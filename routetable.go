@@ -0,0 +1,132 @@
+package mcgoweb
+
+import (
+	"fmt"
+)
+
+// routeTable holds the routes of an application.  A table is never
+// modified once stored, updates replace it with a modified copy so
+// requests in flight keep using the table they started with.
+type routeTable struct {
+	routes      []*Route
+	namedRoutes map[string]*Route
+}
+
+var emptyRouteTable = new(routeTable)
+
+// Registration represents handlers registered together with an
+// application.
+type Registration struct {
+	app    *HTTPApplication
+	routes []*Route
+}
+
+// Unregister removes the registered handlers from the application.
+// Requests already being handled are not affected.
+func (registration *Registration) Unregister() {
+	registration.app.updateRoutes(func(table *routeTable) error {
+		table.remove(registration.routes)
+		return nil
+	})
+}
+
+func (app *HTTPApplication) routeTable() *routeTable {
+	if table := app.routes.Load(); table != nil {
+		return table
+	}
+	return emptyRouteTable
+}
+
+// updateRoutes applies the update to a copy of the route table,
+// replacing the table unless the update returns an error.
+func (app *HTTPApplication) updateRoutes(update func(*routeTable) error) error {
+	app.routesLock.Lock()
+	defer app.routesLock.Unlock()
+
+	table := app.routeTable().clone()
+	if err := update(table); err != nil {
+		return err
+	}
+	app.routes.Store(table)
+	return nil
+}
+
+// addRoutes adds the routes to the application together.
+func (app *HTTPApplication) addRoutes(routes []*Route) (*Registration, error) {
+	err := app.updateRoutes(func(table *routeTable) error {
+		for _, route := range routes {
+			if err := table.add(route); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Registration{app: app, routes: routes}, nil
+}
+
+func (table *routeTable) clone() *routeTable {
+	cloned := &routeTable{
+		routes:      make([]*Route, len(table.routes), len(table.routes)+1),
+		namedRoutes: make(map[string]*Route, len(table.namedRoutes)),
+	}
+	copy(cloned.routes, table.routes)
+	for name, route := range table.namedRoutes {
+		cloned.namedRoutes[name] = route
+	}
+	return cloned
+}
+
+// add inserts the route before any less specific routes, returning
+// an error if its name is taken, an equivalent route is already
+// registered for one of its methods, or either route would shadow
+// the other.
+func (table *routeTable) add(route *Route) error {
+	if _, exists := table.namedRoutes[route.Name]; exists && route.Name != "" {
+		return fmt.Errorf("mcgoweb: duplicate route name %s", route.Name)
+	}
+	position := len(table.routes)
+	for i, existing := range table.routes {
+		if existing.conflictsWith(route) {
+			return fmt.Errorf("mcgoweb: route %s%s conflicts with registered route %s%s", route.Host, route.Path, existing.Host, existing.Path)
+		}
+		if route.precedes(existing) {
+			if route.shadows(existing) {
+				return fmt.Errorf("mcgoweb: route %s%s shadows registered route %s%s", route.Host, route.Path, existing.Host, existing.Path)
+			}
+		} else if existing.shadows(route) {
+			return fmt.Errorf("mcgoweb: route %s%s is shadowed by registered route %s%s", route.Host, route.Path, existing.Host, existing.Path)
+		}
+		if position == len(table.routes) && route.precedes(existing) {
+			position = i
+		}
+	}
+	table.routes = append(table.routes, nil)
+	copy(table.routes[position+1:], table.routes[position:])
+	table.routes[position] = route
+	if route.Name != "" {
+		table.namedRoutes[route.Name] = route
+	}
+	return nil
+}
+
+func (table *routeTable) remove(routes []*Route) {
+	removed := make(map[*Route]bool, len(routes))
+	for _, route := range routes {
+		removed[route] = true
+	}
+	kept := table.routes[:0]
+	for _, route := range table.routes {
+		if !removed[route] {
+			kept = append(kept, route)
+		}
+	}
+	table.routes = kept
+	for name, route := range table.namedRoutes {
+		if removed[route] {
+			delete(table.namedRoutes, name)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package mcgoweb
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestUnregister(t *testing.T) {
+	app := NewHTTPApplication("Unregister Test", "/", "0.0.0.0:7654")
+	NewTestHandler := func(path string) *Handler {
+		handler := NewHandler(path, HTTP_GET)
+		handler.RequestHandler = func(context *RequestContext) {
+			context.Writer.WriteHeader(200)
+		}
+		return handler
+	}
+	unregisterTest := func(t *testing.T, request_path string, expected int) {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, createTestRequest(request_path))
+		if response.Code != expected {
+			t.Errorf("Unexpected response code %d for '%s', expected %d", response.Code, request_path, expected)
+		}
+	}
+
+	plugin := NewBlueprint("/plugin")
+	plugin.Name = "plugin"
+	index := NewTestHandler("/")
+	index.Name = "index"
+	plugin.RegisterHandler(index)
+	plugin.RegisterHandler(NewTestHandler("/<item:int>"))
+	registration, err := app.RegisterBlueprint(plugin)
+	if err != nil {
+		t.Fatalf("Unexpected error registering blueprint: %s", err)
+	}
+	core, err := app.RegisterHandler(NewTestHandler("/core"))
+	if err != nil {
+		t.Fatalf("Unexpected error registering handler: %s", err)
+	}
+	unregisterTest(t, "/plugin", 200)
+	unregisterTest(t, "/plugin/7", 200)
+
+	registration.Unregister()
+	unregisterTest(t, "/plugin", 404)
+	unregisterTest(t, "/plugin/7", 404)
+	unregisterTest(t, "/core", 200)
+	if _, err := app.URLFor("plugin.index", nil, nil); err == nil {
+		t.Errorf("Expected unregistered route name to be removed")
+	}
+
+	// A blueprint is registered completely or not at all
+	conflicting := NewBlueprint("/")
+	conflicting.RegisterHandler(NewTestHandler("/other"))
+	conflicting.RegisterHandler(NewTestHandler("/core"))
+	if _, err := app.RegisterBlueprint(conflicting); err == nil {
+		t.Errorf("Expected conflicting blueprint to return an error")
+	}
+	unregisterTest(t, "/other", 404)
+
+	if _, err := app.RegisterBlueprint(plugin); err != nil {
+		t.Errorf("Unexpected error registering blueprint again: %s", err)
+	}
+	unregisterTest(t, "/plugin/7", 200)
+	core.Unregister()
+	unregisterTest(t, "/core", 404)
+}
+
+func TestConcurrentRegistration(t *testing.T) {
+	app := NewHTTPApplication("Concurrent Test", "/", "0.0.0.0:7654")
+	stable := NewHandler("/stable", HTTP_GET)
+	stable.RequestHandler = func(context *RequestContext) {
+		context.Writer.WriteHeader(200)
+	}
+	if _, err := app.RegisterHandler(stable); err != nil {
+		t.Fatalf("Unexpected error registering handler: %s", err)
+	}
+
+	var wait sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wait.Add(2)
+		go func(i int) {
+			defer wait.Done()
+			for j := 0; j < 50; j++ {
+				handler := NewHandler(fmt.Sprintf("/dynamic/%d/%d", i, j), HTTP_GET)
+				handler.RequestHandler = func(context *RequestContext) {}
+				if registration, err := app.RegisterHandler(handler); err == nil {
+					registration.Unregister()
+				} else {
+					t.Errorf("Unexpected error registering handler: %s", err)
+				}
+			}
+		}(i)
+		go func() {
+			defer wait.Done()
+			for j := 0; j < 50; j++ {
+				response := httptest.NewRecorder()
+				app.ServeHTTP(response, createTestRequest("/stable"))
+				if response.Code != 200 {
+					t.Errorf("Unexpected response code %d during registration", response.Code)
+				}
+			}
+		}()
+	}
+	wait.Wait()
+	if routes := app.Routes(); len(routes) != 1 {
+		t.Errorf("Unexpected routes after unregistering %v", routes)
+	}
+}
@@ -0,0 +1,65 @@
+package mcgoweb
+
+import (
+	"html/template"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	templates := template.Must(template.New("page").Parse(`<script nonce="{{.CSPNonce}}">var user = "{{.Data}}";</script>`))
+	var nonce string
+	NewTestHandler := func() *Handler {
+		handler := NewHandler("/console", HTTP_GET)
+		handler.RequestHandler = func(context *RequestContext) {
+			nonce = context.CSPNonce
+			if err := context.RenderTemplate(templates, "page", "admin"); err != nil {
+				t.Errorf("Unexpected template error: %s", err)
+			}
+		}
+		return handler
+	}
+
+	app := NewHTTPApplication("Security Test", "/", "0.0.0.0:7654")
+	app.AddMiddleware(NewSecurityHeadersMiddleware(DefaultSecurityHeaders()))
+	if _, err := app.Register(NewTestHandler); err != nil {
+		t.Fatalf("Unexpected error registering handler: %s", err)
+	}
+
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, createTestRequest("/console"))
+	if response.Code != 200 {
+		t.Fatalf("Unexpected response code %d, expected 200", response.Code)
+	}
+
+	expected_headers := map[string]string{
+		"Strict-Transport-Security": "max-age=31536000",
+		"X-Content-Type-Options":    "nosniff",
+		"X-Frame-Options":           "DENY",
+		"Referrer-Policy":           "same-origin",
+	}
+	for name, expected := range expected_headers {
+		if actual := response.Header().Get(name); actual != expected {
+			t.Errorf("Unexpected value for header '%s'...\nExpected: '%s'\nActual: '%s'", name, expected, actual)
+		}
+	}
+
+	if nonce == "" {
+		t.Fatalf("Missing CSP nonce on request context")
+	}
+	policy := response.Header().Get("Content-Security-Policy")
+	if expected := "script-src 'self' 'nonce-" + nonce + "'"; !strings.Contains(policy, expected) {
+		t.Errorf("Unexpected Content-Security-Policy...\nExpected to contain: '%s'\nActual: '%s'", expected, policy)
+	}
+	if expected := `<script nonce="` + nonce + `">`; !strings.Contains(response.Body.String(), expected) {
+		t.Errorf("Unexpected body...\nExpected to contain: '%s'\nActual: '%s'", expected, response.Body.String())
+	}
+
+	first_nonce := nonce
+	response = httptest.NewRecorder()
+	app.ServeHTTP(response, createTestRequest("/console"))
+	if nonce == first_nonce {
+		t.Errorf("CSP nonce reused across requests: '%s'", nonce)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math/rand"
 	"net/http"
+	"sync"
 	"time"
 )
 
@@ -111,6 +112,18 @@ func NewUserSession(user string, cache SessionCache) *Session {
 	return session
 }
 
+func (session *Session) clone() *Session {
+	if session == nil {
+		return nil
+	}
+	cloned := *session
+	cloned.values = make(map[string]string, len(session.values))
+	for key, value := range session.values {
+		cloned.values[key] = value
+	}
+	return &cloned
+}
+
 // GetSession returns a session from the given cache using
 // the provided key for lookup.
 func GetSession(key string, cache SessionCache) *Session {
@@ -127,35 +140,63 @@ func GetSession(key string, cache SessionCache) *Session {
 
 // MemorySessionCache provides a SessionCache using an 
 // in-memory object.  Sessions will not be persisted
-// when an application goes offline.
+// when an application goes offline.  It is safe for concurrent use.
 type MemorySessionCache struct {
-	sessions map[SessionId]*Session
+	lock     sync.RWMutex
+	sessions map[SessionId]memorySession
+}
+
+// memorySession holds a session along with its expiration when it
+// was stored.
+type memorySession struct {
+	session    *Session
+	expiration time.Time
 }
 
 func NewMemorySessionCache() SessionCache {
 	cache := new(MemorySessionCache)
-	cache.sessions = make(map[SessionId]*Session)
+	cache.sessions = make(map[SessionId]memorySession)
 	return cache
 }
 
 func (cache *MemorySessionCache) Retrieve(sessionId SessionId) (*Session, error) {
-	session, ok := cache.sessions[sessionId]
+	cache.lock.RLock()
+	defer cache.lock.RUnlock()
+	stored, ok := cache.sessions[sessionId]
 	if !ok {
 		return nil, nil
 	}
-	return session, nil
+	return stored.session, nil
 }
 
 func (cache *MemorySessionCache) Store(sessionId SessionId, session *Session) error {
-	cache.sessions[sessionId] = session
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	cache.sessions[sessionId] = memorySession{session: session, expiration: session.expiration}
 	return nil
 }
 
 func (cache *MemorySessionCache) Delete(sessionId SessionId) error {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
 	delete(cache.sessions, sessionId)
 	return nil
 }
 
+// Count returns the number of unexpired sessions in the cache.
+func (cache *MemorySessionCache) Count() int {
+	now := time.Now()
+	cache.lock.RLock()
+	defer cache.lock.RUnlock()
+	count := 0
+	for _, stored := range cache.sessions {
+		if now.Before(stored.expiration) {
+			count++
+		}
+	}
+	return count
+}
+
 func SessionMiddleware(handler RequestHandler, context *RequestContext) {
 	cookie, err := context.Request.Cookie("SID")
 	if err == nil && len(cookie.Value) > 0 {
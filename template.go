@@ -0,0 +1,85 @@
+package mcgoweb
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+)
+
+// TemplateData represents the data passed to a template rendered
+// through a RequestContext.  The handler supplied value is
+// available as Data alongside request specific values.
+type TemplateData struct {
+	Data        interface{}
+	CSPNonce    string
+	RequestVars map[string]string
+	Session     *Session
+
+	context *RequestContext
+}
+
+// RenderTemplate executes the named template and writes the result
+// to the response.  Nothing is written if the template fails to
+// execute, allowing the handler to respond with an error instead.
+func (context *RequestContext) RenderTemplate(templates *template.Template, name string, data interface{}) error {
+	return context.renderTemplate(templates, name, http.StatusOK, data)
+}
+
+// Render executes the named template from the innermost blueprint of
+// the current route, its parent blueprints, or the application
+// which defines it, and writes the result to the response.
+func (context *RequestContext) Render(name string, data interface{}) error {
+	var blueprint *Blueprint
+	if context.route != nil {
+		blueprint = context.route.blueprint
+	}
+	for ; blueprint != nil; blueprint = blueprint.parent {
+		if blueprint.Templates != nil && blueprint.Templates.Lookup(name) != nil {
+			return context.renderTemplate(blueprint.Templates, name, http.StatusOK, data)
+		}
+	}
+	if context.application != nil && context.application.templates != nil && context.application.templates.Lookup(name) != nil {
+		return context.renderTemplate(context.application.templates, name, http.StatusOK, data)
+	}
+	return fmt.Errorf("mcgoweb: no template named %q", name)
+}
+
+// URLFor returns the path of the named route for use in a template,
+// taking the route's variables as name and value pairs, such as
+// {{.URLFor "users.show" "userid" "17"}}.
+func (data *TemplateData) URLFor(name string, pairs ...string) (string, error) {
+	if len(pairs)%2 != 0 {
+		return "", fmt.Errorf("mcgoweb: URLFor for %q given an odd number of variable arguments", name)
+	}
+	vars := make(map[string]string, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		vars[pairs[i]] = pairs[i+1]
+	}
+	return data.context.URLFor(name, vars, nil)
+}
+
+func (context *RequestContext) renderTemplate(templates *template.Template, name string, status int, data interface{}) error {
+	template_data := &TemplateData{
+		Data:        data,
+		CSPNonce:    context.CSPNonce,
+		RequestVars: context.RequestVars,
+		Session:     context.Session,
+		context:     context,
+	}
+
+	var buffer bytes.Buffer
+	if err := templates.ExecuteTemplate(&buffer, name, template_data); err != nil {
+		return err
+	}
+	if context.Writer.Header().Get("Content-Type") == "" {
+		context.Writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+	// The default status is left to the first write, so a status
+	// already written by the handler is kept
+	if status != http.StatusOK {
+		context.Writer.WriteHeader(status)
+	}
+	_, err := buffer.WriteTo(context.Writer)
+	return err
+}
@@ -0,0 +1,42 @@
+package mcgoweb
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type headerCountingWriter struct {
+	*httptest.ResponseRecorder
+	headers int
+}
+
+func (writer *headerCountingWriter) WriteHeader(status int) {
+	writer.headers++
+	writer.ResponseRecorder.WriteHeader(status)
+}
+
+func TestRenderTemplate(t *testing.T) {
+	templates := template.Must(template.New("page").Parse("page {{.Data}}"))
+	writer := &headerCountingWriter{ResponseRecorder: httptest.NewRecorder()}
+	_, context := createTestRouteAndContext("/", "/")
+	context.Writer = writer
+
+	writer.WriteHeader(http.StatusCreated)
+	if err := context.RenderTemplate(templates, "page", "created"); err != nil {
+		t.Fatalf("Unexpected error rendering template: %s", err)
+	}
+	if writer.headers != 1 || writer.Code != http.StatusCreated || writer.Body.String() != "page created" {
+		t.Errorf("Unexpected response %d '%s' after %d status writes", writer.Code, writer.Body.String(), writer.headers)
+	}
+
+	writer = &headerCountingWriter{ResponseRecorder: httptest.NewRecorder()}
+	context.Writer = writer
+	if err := context.renderTemplate(templates, "page", http.StatusBadRequest, "invalid"); err != nil {
+		t.Fatalf("Unexpected error rendering template: %s", err)
+	}
+	if writer.headers != 1 || writer.Code != http.StatusBadRequest {
+		t.Errorf("Unexpected response %d after %d status writes", writer.Code, writer.headers)
+	}
+}
@@ -0,0 +1,223 @@
+package mcgoweb
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTPPeriod is the time step used for TOTP codes.
+var TOTPPeriod time.Duration = 30 * time.Second
+
+// TOTPDigits is the number of digits in a TOTP code.
+var TOTPDigits int = 6
+
+// TOTPSkew is the number of time steps before and after the
+// current step in which a TOTP code is still accepted.
+var TOTPSkew int = 1
+
+// RecoveryCodeCount is the number of recovery codes generated
+// for a TOTP enrollment.
+var RecoveryCodeCount int = 10
+
+const secondFactorUserKey = "second_factor_user"
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTPEnrollment represents a newly generated TOTP secret and
+// its recovery codes.  URI is an otpauth:// URI suitable for
+// encoding as a QR code for authenticator apps.
+type TOTPEnrollment struct {
+	Secret        string
+	URI           string
+	RecoveryCodes []string
+}
+
+// NewTOTPEnrollment returns a new enrollment for the account,
+// labelled with the issuer in authenticator apps.
+func NewTOTPEnrollment(issuer, account string) (*TOTPEnrollment, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	enrollment := new(TOTPEnrollment)
+	enrollment.Secret = totpEncoding.EncodeToString(secret)
+	enrollment.URI = TOTPURI(issuer, account, enrollment.Secret)
+	for i := 0; i < RecoveryCodeCount; i++ {
+		code := make([]byte, 5)
+		if _, err := rand.Read(code); err != nil {
+			return nil, err
+		}
+		encoded := strings.ToLower(totpEncoding.EncodeToString(code))
+		enrollment.RecoveryCodes = append(enrollment.RecoveryCodes, encoded[:4]+"-"+encoded[4:])
+	}
+	return enrollment, nil
+}
+
+// TOTPURI returns the otpauth:// URI for the secret.
+func TOTPURI(issuer, account, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(TOTPDigits))
+	query.Set("period", fmt.Sprint(int64(TOTPPeriod/time.Second)))
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// TOTPCode returns the RFC 6238 code for the secret at the given
+// time.
+func TOTPCode(secret string, at time.Time) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", err
+	}
+	return totpCode(key, at.Unix()/int64(TOTPPeriod/time.Second)), nil
+}
+
+// VerifyTOTP returns whether the code is valid for the secret at
+// the given time, allowing for TOTPSkew steps of clock skew.  A
+// code stays valid for the whole skew window, so callers must
+// reject replayed codes, see VerifyTOTPStep.
+func VerifyTOTP(secret, code string, at time.Time) bool {
+	_, ok := VerifyTOTPStep(secret, code, at)
+	return ok
+}
+
+// VerifyTOTPStep returns the time step of the code if it is valid
+// for the secret at the given time.  Storing the step of each
+// accepted code and rejecting codes for the same or earlier steps
+// prevents a code from being used twice.
+func VerifyTOTPStep(secret, code string, at time.Time) (int64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil || len(code) != TOTPDigits {
+		return 0, false
+	}
+	step := at.Unix() / int64(TOTPPeriod/time.Second)
+	var matched int64
+	valid := 0
+	for offset := -TOTPSkew; offset <= TOTPSkew; offset++ {
+		match := subtle.ConstantTimeCompare([]byte(totpCode(key, step+int64(offset))), []byte(code))
+		if match == 1 {
+			matched = step + int64(offset)
+		}
+		valid |= match
+	}
+	return matched, valid == 1
+}
+
+func totpCode(key []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	modulus := uint32(1)
+	for i := 0; i < TOTPDigits; i++ {
+		modulus *= 10
+	}
+	return fmt.Sprintf("%0*d", TOTPDigits, value%modulus)
+}
+
+// EnableTOTP enables two-factor authentication for the user with
+// the enrollment's secret and recovery codes.  Only hashes of the
+// recovery codes are kept.
+func (user *User) EnableTOTP(enrollment *TOTPEnrollment) {
+	user.TOTPSecret = enrollment.Secret
+	user.TOTPLastStep = 0
+	user.RecoveryCodes = make([]string, len(enrollment.RecoveryCodes))
+	for i, code := range enrollment.RecoveryCodes {
+		user.RecoveryCodes[i] = hashRecoveryCode(code)
+	}
+}
+
+// VerifySecondFactor returns whether the code is a valid TOTP code
+// or unused recovery code for the user.  TOTP codes for a time
+// step at or before the last accepted step are refused.  The
+// accepted step is recorded and a recovery code is removed from
+// the user when used, so the user must be stored again afterwards.
+func (user *User) VerifySecondFactor(code string, at time.Time) bool {
+	code = strings.TrimSpace(code)
+	if user.TOTPSecret == "" {
+		return false
+	}
+	if step, ok := VerifyTOTPStep(user.TOTPSecret, code, at); ok {
+		if step <= user.TOTPLastStep {
+			return false
+		}
+		user.TOTPLastStep = step
+		return true
+	}
+	hash := hashRecoveryCode(code)
+	for i, recovery := range user.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(recovery), []byte(hash)) == 1 {
+			user.RecoveryCodes = append(user.RecoveryCodes[:i:i], user.RecoveryCodes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return hex.EncodeToString(sum[:])
+}
+
+// StartSecondFactorSession creates a new session in the current
+// context for a user whose password has been verified but who
+// still needs to provide a second factor.  The session has no
+// user until CompleteSecondFactor is called, and previous failures
+// are kept so the password can not be used to reset the limit on
+// guessing codes.  Each invalid code should be recorded with
+// LoginFailed.
+func (context *RequestContext) StartSecondFactorSession(user string) {
+	context.StartSession("")
+	context.Session.UpdateValue(secondFactorUserKey, user)
+	context.ReleaseLogin(user)
+}
+
+// CompleteSecondFactor replaces a session waiting on a second
+// factor with a session for its user, recording the successful
+// login.
+func (context *RequestContext) CompleteSecondFactor() {
+	if user, ok := context.Session.PendingSecondFactor(); ok {
+		context.StartSession(user)
+	}
+}
+
+// PendingSecondFactor returns the user of a session waiting on a
+// second factor.
+func (session *Session) PendingSecondFactor() (string, bool) {
+	if session == nil {
+		return "", false
+	}
+	user, ok := session.GetValue(secondFactorUserKey)
+	return user, ok && user != ""
+}
+
+// RequireLoginMiddleware responds with 401 Unauthorized unless the
+// request has a session for a user.  Sessions waiting on a second
+// factor are refused.  SessionMiddleware must be called before it.
+func RequireLoginMiddleware(handler RequestHandler, context *RequestContext) {
+	if context.Session != nil {
+		if user, _ := context.Session.GetValue("user"); user != "" {
+			handler(context)
+			return
+		}
+	}
+	http.Error(context.Writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
@@ -0,0 +1,167 @@
+package mcgoweb
+
+import (
+	"encoding/base32"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 SHA1 test vectors truncated to six digits.
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for at, expected := range vectors {
+		if actual, _ := TOTPCode(secret, time.Unix(at, 0)); actual != expected {
+			t.Errorf("Unexpected TOTP code at %d...\nExpected: '%s'\nActual: '%s'", at, expected, actual)
+		}
+	}
+
+	now := time.Unix(1234567890, 0)
+	previous, _ := TOTPCode(secret, now.Add(-TOTPPeriod))
+	if !VerifyTOTP(secret, previous, now) {
+		t.Errorf("Code from previous step rejected")
+	}
+	stale, _ := TOTPCode(secret, now.Add(-2*TOTPPeriod))
+	if VerifyTOTP(secret, stale, now) {
+		t.Errorf("Code from two steps ago accepted")
+	}
+}
+
+func TestTOTPEnrollment(t *testing.T) {
+	enrollment, err := NewTOTPEnrollment("Example Console", "ops@example.com")
+	if err != nil {
+		t.Fatalf("Unexpected enrollment error: %s", err)
+	}
+	if expected := "otpauth://totp/Example%20Console:ops@example.com?"; !strings.HasPrefix(enrollment.URI, expected) {
+		t.Errorf("Unexpected URI...\nExpected prefix: '%s'\nActual: '%s'", expected, enrollment.URI)
+	}
+	if len(enrollment.RecoveryCodes) != RecoveryCodeCount {
+		t.Errorf("Unexpected recovery code count %d, expected %d", len(enrollment.RecoveryCodes), RecoveryCodeCount)
+	}
+
+	user := &User{Name: "ops@example.com"}
+	user.EnableTOTP(enrollment)
+	recovery := enrollment.RecoveryCodes[3]
+	if !user.VerifySecondFactor(recovery, time.Now()) {
+		t.Fatalf("Recovery code rejected")
+	}
+	if user.VerifySecondFactor(recovery, time.Now()) {
+		t.Errorf("Recovery code accepted twice")
+	}
+	if len(user.RecoveryCodes) != RecoveryCodeCount-1 {
+		t.Errorf("Unexpected recovery code count %d, expected %d", len(user.RecoveryCodes), RecoveryCodeCount-1)
+	}
+
+	now := time.Now()
+	code, _ := TOTPCode(enrollment.Secret, now)
+	if !user.VerifySecondFactor(code, now) {
+		t.Fatalf("TOTP code rejected")
+	}
+	if user.VerifySecondFactor(code, now.Add(TOTPPeriod)) {
+		t.Errorf("TOTP code accepted twice")
+	}
+	previous, _ := TOTPCode(enrollment.Secret, now.Add(-TOTPPeriod))
+	if user.VerifySecondFactor(previous, now) {
+		t.Errorf("TOTP code for an earlier step accepted")
+	}
+}
+
+func TestSecondFactorLogin(t *testing.T) {
+	hasher := &PasswordHasher{Iterations: 10, SaltLength: 16, KeyLength: 32}
+	enrollment, _ := NewTOTPEnrollment("Test", "admin")
+	admin := &User{Name: "admin"}
+	admin.SetPassword("password", hasher)
+	admin.EnableTOTP(enrollment)
+	users := NewMemoryUserStore()
+	users.PutUser(admin)
+
+	NewProtectedHandler := func() *Handler {
+		handler := NewHandler("/console", HTTP_GET)
+		handler.AddMiddleware(SessionMiddleware)
+		handler.AddMiddleware(RequireLoginMiddleware)
+		handler.RequestHandler = func(context *RequestContext) {
+			context.Writer.WriteHeader(200)
+		}
+		return handler
+	}
+
+	tracker := NewLoginAttemptTracker()
+	app := NewHTTPApplication("Second Factor Test", "/", "0.0.0.0:7654")
+	app.SetSessionCache(NewMemorySessionCache())
+	app.SetLoginAttemptTracker(tracker)
+	if _, err := app.RegisterBlueprint(NewPasswordLoginBlueprint("/auth", PasswordLoginConfiguration{
+		Users:       users,
+		Hasher:      hasher,
+		SuccessPath: "/console",
+	})); err != nil {
+		t.Fatalf("Unexpected error registering blueprint: %s", err)
+	}
+	if _, err := app.Register(NewProtectedHandler); err != nil {
+		t.Fatalf("Unexpected error registering handler: %s", err)
+	}
+
+	request := func(method, path string, form url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+		request := createTestRequest(path)
+		request.Method = method
+		request.Header = make(http.Header)
+		if form != nil {
+			request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			request.Body = ioutil.NopCloser(strings.NewReader(form.Encode()))
+		}
+		if cookie != nil {
+			request.AddCookie(cookie)
+		}
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		return response
+	}
+
+	response := request("POST", "/auth/login", url.Values{"username": {"admin"}, "password": {"password"}}, nil)
+	if expected := "/auth/totp"; response.Header().Get("Location") != expected {
+		t.Fatalf("Unexpected login redirect...\nExpected: '%s'\nActual: '%s'", expected, response.Header().Get("Location"))
+	}
+	pending := response.Result().Cookies()[0]
+
+	response = request("GET", "/console", nil, pending)
+	if response.Code != 401 {
+		t.Errorf("Unexpected response code %d with second factor pending, expected 401", response.Code)
+	}
+
+	response = request("POST", "/auth/totp", url.Values{"code": {"000000x"}}, pending)
+	if response.Code != 401 {
+		t.Errorf("Unexpected response code %d for invalid code, expected 401", response.Code)
+	}
+	request("POST", "/auth/login", url.Values{"username": {"admin"}, "password": {"password"}}, nil)
+	if attempts := tracker.attempts["user:admin"]; attempts == nil || attempts.failures != 1 {
+		t.Errorf("Expected password login to keep the failed code attempt")
+	}
+
+	code, _ := TOTPCode(enrollment.Secret, time.Now())
+	response = request("POST", "/auth/totp", url.Values{"code": {code}}, pending)
+	if expected := "/console"; response.Header().Get("Location") != expected {
+		t.Fatalf("Unexpected second factor redirect...\nExpected: '%s'\nActual: '%s'", expected, response.Header().Get("Location"))
+	}
+
+	if _, ok := tracker.attempts["user:admin"]; ok {
+		t.Errorf("Expected failures to be cleared after the second factor")
+	}
+
+	response = request("GET", "/console", nil, response.Result().Cookies()[0])
+	if response.Code != 200 {
+		t.Errorf("Unexpected response code %d after second factor, expected 200", response.Code)
+	}
+	response = request("GET", "/console", nil, pending)
+	if response.Code != 401 {
+		t.Errorf("Unexpected response code %d for replaced pending session, expected 401", response.Code)
+	}
+}
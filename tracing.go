@@ -0,0 +1,715 @@
+package mcgoweb
+
+import (
+	"bytes"
+	stdcontext "context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TraceID and SpanID identify traces and spans as defined by W3C
+// Trace Context.
+type TraceID [16]byte
+type SpanID [8]byte
+
+// String returns the lowercase hex encoding of the trace id.
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// String returns the lowercase hex encoding of the span id.
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanContext represents the trace context propagated between
+// services in the traceparent and tracestate headers.
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Sampled    bool
+	TraceState string
+}
+
+// ParseTraceparent parses a W3C traceparent header value.
+func ParseTraceparent(value string) (SpanContext, error) {
+	var span_context SpanContext
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return span_context, fmt.Errorf("mcgoweb: invalid traceparent %q", value)
+	}
+	if !lowerHex(parts[1], len(span_context.TraceID)) {
+		return span_context, fmt.Errorf("mcgoweb: invalid traceparent trace id %q", parts[1])
+	}
+	hex.Decode(span_context.TraceID[:], []byte(parts[1]))
+	if !lowerHex(parts[2], len(span_context.SpanID)) {
+		return span_context, fmt.Errorf("mcgoweb: invalid traceparent parent id %q", parts[2])
+	}
+	hex.Decode(span_context.SpanID[:], []byte(parts[2]))
+	if span_context.TraceID == (TraceID{}) || span_context.SpanID == (SpanID{}) {
+		return span_context, fmt.Errorf("mcgoweb: invalid traceparent %q", value)
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil || len(parts[3]) != 2 {
+		return span_context, fmt.Errorf("mcgoweb: invalid traceparent flags %q", parts[3])
+	}
+	span_context.Sampled = flags&1 == 1
+	return span_context, nil
+}
+
+// lowerHex returns whether the value is the lowercase hex encoding
+// of the given number of bytes.
+func lowerHex(value string, size int) bool {
+	if len(value) != 2*size {
+		return false
+	}
+	for i := 0; i < len(value); i++ {
+		if !('0' <= value[i] && value[i] <= '9' || 'a' <= value[i] && value[i] <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// Traceparent returns the traceparent header value for the span.
+func (span_context SpanContext) Traceparent() string {
+	flags := "00"
+	if span_context.Sampled {
+		flags = "01"
+	}
+	return "00-" + span_context.TraceID.String() + "-" + span_context.SpanID.String() + "-" + flags
+}
+
+// SpanKind describes the relationship of a span to its trace, with
+// the values used by OpenTelemetry.
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// Span represents a timed operation within a trace.  Spans are
+// exported once they end, when sampled.
+type Span struct {
+	SpanContext
+	Name       string
+	ParentID   SpanID
+	Kind       SpanKind
+	StartTime  time.Time
+	EndTime    time.Time
+	Attributes map[string]string
+	Error      bool
+
+	tracer *Tracer
+	trace  *traceBuffer
+	local  bool
+	lock   sync.Mutex
+}
+
+// traceBuffer collects the ended spans of a request so they are
+// exported together when the request's span ends.
+type traceBuffer struct {
+	lock  sync.Mutex
+	spans []*Span
+	done  bool
+}
+
+// SetAttribute sets an attribute of the span.  Like End, it may be
+// called on a nil span.
+func (span *Span) SetAttribute(key, value string) {
+	if span == nil {
+		return
+	}
+	span.lock.Lock()
+	defer span.lock.Unlock()
+	if span.Attributes == nil {
+		span.Attributes = make(map[string]string)
+	}
+	span.Attributes[key] = value
+}
+
+// attributes returns a copy of the span's attributes.
+func (span *Span) attributes() map[string]string {
+	span.lock.Lock()
+	defer span.lock.Unlock()
+	attributes := make(map[string]string, len(span.Attributes))
+	for key, value := range span.Attributes {
+		attributes[key] = value
+	}
+	return attributes
+}
+
+// End ends the span.  Spans of a request are exported when the
+// request's span ends, spans ending after it are exported alone.
+func (span *Span) End() {
+	if span == nil {
+		return
+	}
+	span.EndTime = time.Now()
+	if !span.Sampled || span.tracer == nil {
+		return
+	}
+	span.trace.lock.Lock()
+	if span.trace.done {
+		span.trace.lock.Unlock()
+		span.tracer.export([]*Span{span})
+		return
+	}
+	span.trace.spans = append(span.trace.spans, span)
+	if !span.local {
+		span.trace.lock.Unlock()
+		return
+	}
+	spans := span.trace.spans
+	span.trace.spans = nil
+	span.trace.done = true
+	span.trace.lock.Unlock()
+	span.tracer.export(spans)
+}
+
+// SpanExporter sends ended spans to a tracing backend.
+type SpanExporter interface {
+	Export(spans []*Span) error
+}
+
+// DefaultTraceQueueSize, DefaultTraceBatchSize and
+// DefaultTraceBatchInterval are used by tracers which do not set
+// their own.
+var DefaultTraceQueueSize = 2048
+var DefaultTraceBatchSize = 512
+var DefaultTraceBatchInterval = 5 * time.Second
+
+// Tracer creates spans and exports them with its exporter.  Ended
+// spans are queued and exported in batches of up to BatchSize in
+// the background, at least every BatchInterval, so requests never
+// wait on the exporter.  Spans are dropped when the queue of
+// QueueSize spans is full.  Shutdown should be called before the
+// application exits to export the queued spans.
+type Tracer struct {
+	Exporter      SpanExporter
+	QueueSize     int
+	BatchSize     int
+	BatchInterval time.Duration
+
+	start_once sync.Once
+	lock       sync.RWMutex
+	closed     bool
+	queue      chan *Span
+	flush      chan chan struct{}
+	done       chan struct{}
+	dropped    atomic.Int64
+}
+
+// NewTracer returns a new tracer exporting spans with the exporter.
+func NewTracer(exporter SpanExporter) *Tracer {
+	return &Tracer{
+		Exporter:      exporter,
+		QueueSize:     DefaultTraceQueueSize,
+		BatchSize:     DefaultTraceBatchSize,
+		BatchInterval: DefaultTraceBatchInterval,
+	}
+}
+
+// Dropped returns the number of spans dropped because the export
+// queue was full or the tracer was shut down.
+func (tracer *Tracer) Dropped() int64 {
+	return tracer.dropped.Load()
+}
+
+// Flush waits until the spans queued so far have been exported or
+// the context is done.
+func (tracer *Tracer) Flush(ctx stdcontext.Context) error {
+	tracer.run()
+	reply := make(chan struct{})
+	select {
+	case tracer.flush <- reply:
+	case <-tracer.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-reply:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown stops the tracer after exporting the queued spans, or
+// when the context is done.  Spans ending afterwards are dropped.
+func (tracer *Tracer) Shutdown(ctx stdcontext.Context) error {
+	tracer.run()
+	tracer.lock.Lock()
+	if !tracer.closed {
+		tracer.closed = true
+		close(tracer.queue)
+	}
+	tracer.lock.Unlock()
+	select {
+	case <-tracer.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// export queues the spans for export, dropping those which do not
+// fit in the queue.
+func (tracer *Tracer) export(spans []*Span) {
+	tracer.run()
+	tracer.lock.RLock()
+	defer tracer.lock.RUnlock()
+	for _, span := range spans {
+		if tracer.closed {
+			tracer.dropped.Add(1)
+			continue
+		}
+		select {
+		case tracer.queue <- span:
+		default:
+			tracer.dropped.Add(1)
+		}
+	}
+}
+
+// run starts the export goroutine on first use.
+func (tracer *Tracer) run() {
+	tracer.start_once.Do(func() {
+		queue_size, batch_size, interval := tracer.QueueSize, tracer.BatchSize, tracer.BatchInterval
+		if queue_size <= 0 {
+			queue_size = DefaultTraceQueueSize
+		}
+		if batch_size <= 0 {
+			batch_size = DefaultTraceBatchSize
+		}
+		if interval <= 0 {
+			interval = DefaultTraceBatchInterval
+		}
+		tracer.queue = make(chan *Span, queue_size)
+		tracer.flush = make(chan chan struct{})
+		tracer.done = make(chan struct{})
+		go tracer.exportBatches(batch_size, interval)
+	})
+}
+
+func (tracer *Tracer) exportBatches(batch_size int, interval time.Duration) {
+	defer close(tracer.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := tracer.Exporter.Export(batch); err != nil {
+			log.Println("Trace export error:", err)
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case span, ok := <-tracer.queue:
+			if !ok {
+				send()
+				return
+			}
+			batch = append(batch, span)
+			if len(batch) >= batch_size {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case reply := <-tracer.flush:
+			for queued := len(tracer.queue); queued > 0; queued-- {
+				batch = append(batch, <-tracer.queue)
+				if len(batch) >= batch_size {
+					send()
+				}
+			}
+			send()
+			close(reply)
+		}
+	}
+}
+
+// start returns a new span which is a child of the parent context,
+// or the root of a new sampled trace without a parent.  Spans
+// whose ids can not be generated are not sampled.
+func (tracer *Tracer) start(name string, kind SpanKind, parent SpanContext, trace *traceBuffer) *Span {
+	span := &Span{Name: name, Kind: kind, StartTime: time.Now(), tracer: tracer, trace: trace}
+	var err error
+	if parent.TraceID == (TraceID{}) {
+		_, err = rand.Read(span.TraceID[:])
+		span.Sampled = true
+	} else {
+		span.TraceID = parent.TraceID
+		span.ParentID = parent.SpanID
+		span.Sampled = parent.Sampled
+		span.TraceState = parent.TraceState
+	}
+	if err == nil {
+		_, err = rand.Read(span.SpanID[:])
+	}
+	if err != nil {
+		log.Println("Trace id generation failed:", err)
+		span.Sampled = false
+	}
+	if span.trace == nil {
+		span.trace = new(traceBuffer)
+		span.local = true
+	}
+	return span
+}
+
+type spanContextKey struct{}
+
+// SpanFromContext returns the current span of the context, or nil
+// when the context is not traced.
+func SpanFromContext(ctx stdcontext.Context) *Span {
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+// ContextWithSpan returns a copy of the context with the span as
+// its current span.
+func ContextWithSpan(ctx stdcontext.Context, span *Span) stdcontext.Context {
+	return stdcontext.WithValue(ctx, spanContextKey{}, span)
+}
+
+// StartSpan starts a child span of the context's current span,
+// returning a context with the new span as the current span.  The
+// span is nil when the context is not traced, which may still be
+// ended.
+func StartSpan(ctx stdcontext.Context, name string) (stdcontext.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil || parent.tracer == nil {
+		return ctx, nil
+	}
+	span := parent.tracer.start(name, SpanKindInternal, parent.SpanContext, parent.trace)
+	return ContextWithSpan(ctx, span), span
+}
+
+// InjectTraceContext sets the traceparent and tracestate headers
+// for the context's current span.
+func InjectTraceContext(ctx stdcontext.Context, header http.Header) {
+	span := SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	header.Set("Traceparent", span.Traceparent())
+	if span.TraceState != "" {
+		header.Set("Tracestate", span.TraceState)
+	} else {
+		header.Del("Tracestate")
+	}
+}
+
+// SetTracer sets the tracer tracing the application's requests.
+// Every request is traced with a span named after the matched
+// route pattern, including requests which match no route.  The
+// trace is continued from the request's traceparent and tracestate
+// headers when present.  Middleware is traced with a span per
+// middleware, and the request's span is the current span of its
+// context for handlers to start their own spans with StartSpan.
+func (app *HTTPApplication) SetTracer(tracer *Tracer) {
+	app.tracer = tracer
+}
+
+// NewTracingMiddleware returns a middleware tracing the requests
+// of the handlers it is added to, as SetTracer does for the whole
+// application.  Requests already traced are not traced again.
+func NewTracingMiddleware(tracer *Tracer) Middleware {
+	return func(handler RequestHandler, context *RequestContext) {
+		if context.span != nil {
+			handler(context)
+			return
+		}
+		defer tracer.traceRequest(context)()
+		handler(context)
+	}
+}
+
+// traceRequest starts the span of a request, returning the function
+// ending it once the request has been handled.
+func (tracer *Tracer) traceRequest(context *RequestContext) func() {
+	parent, err := ParseTraceparent(context.Request.Header.Get("Traceparent"))
+	if err == nil {
+		parent.TraceState = strings.Join(context.Request.Header.Values("Tracestate"), ",")
+	} else {
+		parent = SpanContext{}
+	}
+	span := tracer.start(context.Request.Method, SpanKindServer, parent, nil)
+	span.SetAttribute("http.request.method", context.Request.Method)
+	span.SetAttribute("url.path", context.Request.URL.Path)
+
+	outer_span, outer_request := context.span, context.Request
+	context.span = span
+	context.Request = context.Request.WithContext(ContextWithSpan(context.Request.Context(), span))
+	return func() {
+		context.span, context.Request = outer_span, outer_request
+		if context.route != nil {
+			pattern := context.route.Host + context.route.Path
+			span.Name += " " + pattern
+			span.SetAttribute("http.route", pattern)
+		}
+		status := http.StatusOK
+		if context.response != nil && context.response.Status() != 0 {
+			status = context.response.Status()
+		}
+		span.SetAttribute("http.response.status_code", strconv.Itoa(status))
+		span.Error = status >= 500
+		span.End()
+	}
+}
+
+// traceMiddlewareStage calls the middleware within a span when the
+// request is traced.
+func traceMiddlewareStage(middleware Middleware, name string, handler RequestHandler, context *RequestContext) {
+	if context.span == nil {
+		middleware(handler, context)
+		return
+	}
+	parent, request := context.span, context.Request
+	span := parent.tracer.start("middleware "+name, SpanKindInternal, parent.SpanContext, parent.trace)
+	context.span = span
+	context.Request = request.WithContext(ContextWithSpan(request.Context(), span))
+	defer func() {
+		context.span, context.Request = parent, request
+		span.End()
+	}()
+	middleware(handler, context)
+}
+
+// TracingTransport is an http.RoundTripper tracing outbound
+// requests with a client span and propagating the trace context
+// of the request's context to the server.
+type TracingTransport struct {
+	Base http.RoundTripper
+}
+
+// NewTracingClient returns an http.Client propagating the trace
+// context of requests made with it.
+func NewTracingClient() *http.Client {
+	return &http.Client{Transport: &TracingTransport{}}
+}
+
+func (transport *TracingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	base := transport.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	parent := SpanFromContext(request.Context())
+	if parent == nil || parent.tracer == nil {
+		return base.RoundTrip(request)
+	}
+	span := parent.tracer.start(request.Method, SpanKindClient, parent.SpanContext, parent.trace)
+	span.SetAttribute("http.request.method", request.Method)
+	span.SetAttribute("url.full", request.URL.Redacted())
+
+	outbound := request.Clone(ContextWithSpan(request.Context(), span))
+	InjectTraceContext(outbound.Context(), outbound.Header)
+	response, err := base.RoundTrip(outbound)
+	if err != nil {
+		span.Error = true
+	} else {
+		span.SetAttribute("http.response.status_code", strconv.Itoa(response.StatusCode))
+		span.Error = response.StatusCode >= 500
+	}
+	span.End()
+	return response, err
+}
+
+// MemorySpanExporter keeps exported spans in memory, for tests
+// and debugging.
+type MemorySpanExporter struct {
+	lock  sync.Mutex
+	spans []*Span
+}
+
+// NewMemorySpanExporter returns a new in-memory exporter.
+func NewMemorySpanExporter() *MemorySpanExporter {
+	return new(MemorySpanExporter)
+}
+
+func (exporter *MemorySpanExporter) Export(spans []*Span) error {
+	exporter.lock.Lock()
+	exporter.spans = append(exporter.spans, spans...)
+	exporter.lock.Unlock()
+	return nil
+}
+
+// Spans returns the spans exported so far.
+func (exporter *MemorySpanExporter) Spans() []*Span {
+	exporter.lock.Lock()
+	defer exporter.lock.Unlock()
+	return append([]*Span(nil), exporter.spans...)
+}
+
+// WriterSpanExporter writes each exported span as a line of JSON.
+type WriterSpanExporter struct {
+	lock   sync.Mutex
+	writer io.Writer
+}
+
+// NewStdoutSpanExporter returns an exporter writing spans to
+// standard output.
+func NewStdoutSpanExporter() *WriterSpanExporter {
+	return NewWriterSpanExporter(os.Stdout)
+}
+
+// NewWriterSpanExporter returns an exporter writing spans to the
+// writer.
+func NewWriterSpanExporter(writer io.Writer) *WriterSpanExporter {
+	return &WriterSpanExporter{writer: writer}
+}
+
+func (exporter *WriterSpanExporter) Export(spans []*Span) error {
+	exporter.lock.Lock()
+	defer exporter.lock.Unlock()
+	encoder := json.NewEncoder(exporter.writer)
+	for _, span := range spans {
+		record := map[string]interface{}{
+			"name":       span.Name,
+			"trace_id":   span.TraceID.String(),
+			"span_id":    span.SpanID.String(),
+			"kind":       span.Kind,
+			"start":      span.StartTime,
+			"duration":   span.EndTime.Sub(span.StartTime).String(),
+			"attributes": span.attributes(),
+			"error":      span.Error,
+		}
+		if span.ParentID != (SpanID{}) {
+			record["parent_id"] = span.ParentID.String()
+		}
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OTLPSpanExporter sends spans to an OpenTelemetry collector using
+// OTLP over HTTP with JSON encoding.  Endpoint is the collector's
+// traces URL, such as "http://localhost:4318/v1/traces".
+type OTLPSpanExporter struct {
+	Endpoint    string
+	ServiceName string
+	Header      http.Header
+	Client      *http.Client
+}
+
+// NewOTLPSpanExporter returns an exporter sending spans to the
+// collector endpoint.
+func NewOTLPSpanExporter(endpoint, service_name string) *OTLPSpanExporter {
+	return &OTLPSpanExporter{
+		Endpoint:    endpoint,
+		ServiceName: service_name,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	TraceState        string          `json:"traceState,omitempty"`
+	Name              string          `json:"name"`
+	Kind              SpanKind        `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            struct {
+		Code int `json:"code,omitempty"`
+	} `json:"status"`
+}
+
+func newOTLPAttribute(key, value string) otlpAttribute {
+	attribute := otlpAttribute{Key: key}
+	attribute.Value.StringValue = value
+	return attribute
+}
+
+func (exporter *OTLPSpanExporter) Export(spans []*Span) error {
+	encoded := make([]otlpSpan, len(spans))
+	for i, span := range spans {
+		encoded[i] = otlpSpan{
+			TraceID:           span.TraceID.String(),
+			SpanID:            span.SpanID.String(),
+			TraceState:        span.TraceState,
+			Name:              span.Name,
+			Kind:              span.Kind,
+			StartTimeUnixNano: strconv.FormatInt(span.StartTime.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.EndTime.UnixNano(), 10),
+		}
+		if span.ParentID != (SpanID{}) {
+			encoded[i].ParentSpanID = span.ParentID.String()
+		}
+		for key, value := range span.attributes() {
+			encoded[i].Attributes = append(encoded[i].Attributes, newOTLPAttribute(key, value))
+		}
+		if span.Error {
+			encoded[i].Status.Code = 2
+		}
+	}
+	payload := map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": []otlpAttribute{newOTLPAttribute("service.name", exporter.ServiceName)},
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "github.com/dmcgowan/mcgoweb"},
+				"spans": encoded,
+			}},
+		}},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest("POST", exporter.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, values := range exporter.Header {
+		request.Header[name] = values
+	}
+	request.Header.Set("Content-Type", "application/json")
+	client := exporter.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, response.Body)
+	response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return errors.New("mcgoweb: OTLP export failed with status " + response.Status)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package mcgoweb
+
+import (
+	stdcontext "context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	value := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	span_context, err := ParseTraceparent(value)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing traceparent: %s", err)
+	}
+	if !span_context.Sampled || span_context.SpanID.String() != "00f067aa0ba902b7" {
+		t.Errorf("Unexpected span context %+v", span_context)
+	}
+	if actual := span_context.Traceparent(); actual != value {
+		t.Errorf("Unexpected traceparent '%s', expected '%s'", actual, value)
+	}
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473600-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b700-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-+0f067aa0ba902b7-01",
+	} {
+		if _, err := ParseTraceparent(invalid); err == nil {
+			t.Errorf("Expected traceparent %q to be invalid", invalid)
+		}
+	}
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	var outbound http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		outbound = request.Header
+	}))
+	defer backend.Close()
+
+	exporter := NewMemorySpanExporter()
+	tracer := NewTracer(exporter)
+	defer tracer.Shutdown(stdcontext.Background())
+	app := NewHTTPApplication("Tracing Test", "/", "0.0.0.0:7654")
+	app.SetTracer(tracer)
+	app.AddMiddleware(SessionMiddleware)
+	handler := NewHandler("/users/<id:int>", HTTP_GET)
+	handler.RequestHandler = func(context *RequestContext) {
+		ctx, span := StartSpan(context.Request.Context(), "load user")
+		defer span.End()
+		request, _ := http.NewRequestWithContext(ctx, "GET", backend.URL, nil)
+		if response, err := NewTracingClient().Do(request); err == nil {
+			io.Copy(io.Discard, response.Body)
+			response.Body.Close()
+		}
+	}
+	if _, err := app.RegisterHandler(handler); err != nil {
+		t.Fatalf("Unexpected error registering handler: %s", err)
+	}
+
+	request := createTestRequest("/users/7")
+	request.Header = http.Header{
+		"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		"Tracestate":  {"vendor=value"},
+	}
+	app.ServeHTTP(httptest.NewRecorder(), request)
+	if err := tracer.Flush(stdcontext.Background()); err != nil {
+		t.Fatalf("Unexpected error flushing spans: %s", err)
+	}
+
+	spans := exporter.Spans()
+	if len(spans) != 4 {
+		t.Fatalf("Unexpected number of spans %d, expected 4", len(spans))
+	}
+	named := make(map[string]*Span)
+	for _, span := range spans {
+		named[span.Name] = span
+		if actual := span.TraceID.String(); actual != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("Span %q has unexpected trace id %s", span.Name, actual)
+		}
+	}
+	server := named["GET /users/<id:int>"]
+	stage := named["middleware mcgoweb.SessionMiddleware"]
+	load := named["load user"]
+	client := named["GET"]
+	if server == nil || stage == nil || load == nil || client == nil {
+		t.Fatalf("Missing expected spans: %v", named)
+	}
+	if server.ParentID.String() != "00f067aa0ba902b7" || server.Kind != SpanKindServer {
+		t.Errorf("Unexpected server span parent %s", server.ParentID)
+	}
+	if stage.ParentID != server.SpanID || load.ParentID != stage.SpanID || client.ParentID != load.SpanID {
+		t.Errorf("Unexpected span hierarchy")
+	}
+	if actual := server.Attributes["http.response.status_code"]; actual != "200" {
+		t.Errorf("Unexpected status code attribute '%s'", actual)
+	}
+
+	expected := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + client.SpanID.String() + "-01"
+	if actual := outbound.Get("Traceparent"); actual != expected {
+		t.Errorf("Unexpected outbound traceparent '%s', expected '%s'", actual, expected)
+	}
+	if actual := outbound.Get("Tracestate"); actual != "vendor=value" {
+		t.Errorf("Unexpected outbound tracestate '%s'", actual)
+	}
+
+	app.ServeHTTP(httptest.NewRecorder(), createTestRequest("/missing"))
+	tracer.Flush(stdcontext.Background())
+	spans = exporter.Spans()
+	if missing := spans[len(spans)-1]; missing.Name != "GET" || missing.Attributes["http.response.status_code"] != "404" {
+		t.Errorf("Unexpected span %q for unmatched request", missing.Name)
+	}
+
+	request = createTestRequest("/missing")
+	request.Header = http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e473600-b7ad6b7169203331-01"}}
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, request)
+	if response.Code != 404 {
+		t.Errorf("Unexpected response code %d for over-long trace id, expected 404", response.Code)
+	}
+}
+
+type blockingSpanExporter struct {
+	release chan struct{}
+}
+
+func (exporter *blockingSpanExporter) Export(spans []*Span) error {
+	<-exporter.release
+	return nil
+}
+
+func TestTracerQueue(t *testing.T) {
+	exporter := &blockingSpanExporter{release: make(chan struct{})}
+	tracer := NewTracer(exporter)
+	tracer.QueueSize = 2
+	tracer.BatchSize = 1
+
+	// The first span is held by the blocked exporter, the next two
+	// fill the queue and the rest are dropped without blocking.
+	for i := 0; i < 6; i++ {
+		tracer.start("operation", SpanKindInternal, SpanContext{}, nil).End()
+		if i == 0 {
+			for len(tracer.queue) > 0 {
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}
+	if dropped := tracer.Dropped(); dropped != 3 {
+		t.Errorf("Unexpected number of dropped spans %d, expected 3", dropped)
+	}
+	close(exporter.release)
+	if err := tracer.Shutdown(stdcontext.Background()); err != nil {
+		t.Errorf("Unexpected error shutting down: %s", err)
+	}
+	tracer.start("operation", SpanKindInternal, SpanContext{}, nil).End()
+	if dropped := tracer.Dropped(); dropped != 4 {
+		t.Errorf("Expected span ending after shutdown to be dropped")
+	}
+}
+
+func TestOTLPSpanExporter(t *testing.T) {
+	var payload map[string]interface{}
+	collector := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		json.NewDecoder(request.Body).Decode(&payload)
+	}))
+	defer collector.Close()
+
+	tracer := NewTracer(NewOTLPSpanExporter(collector.URL+"/v1/traces", "test-service"))
+	span := tracer.start("operation", SpanKindInternal, SpanContext{}, nil)
+	span.End()
+	if err := tracer.Shutdown(stdcontext.Background()); err != nil {
+		t.Fatalf("Unexpected error shutting down: %s", err)
+	}
+
+	resource_spans, _ := payload["resourceSpans"].([]interface{})
+	if len(resource_spans) != 1 {
+		t.Fatalf("Unexpected OTLP payload %v", payload)
+	}
+	scope_spans := resource_spans[0].(map[string]interface{})["scopeSpans"].([]interface{})
+	spans := scope_spans[0].(map[string]interface{})["spans"].([]interface{})
+	exported := spans[0].(map[string]interface{})
+	if exported["name"] != "operation" || exported["traceId"] != span.TraceID.String() {
+		t.Errorf("Unexpected exported span %v", exported)
+	}
+}
@@ -0,0 +1,132 @@
+package mcgoweb
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// URLFor returns the path of the named route with its variables
+// filled in from vars and the query appended.  Handlers in a
+// named blueprint are named "<blueprint>.<handler>".  An error is
+// returned if a variable is missing, unknown, or has a value the
+// route would not match.  Variables of a route's host pattern are
+// checked when given, but only the path is returned.
+func (app *HTTPApplication) URLFor(name string, vars map[string]string, query url.Values) (string, error) {
+	route, ok := app.routeTable().namedRoutes[name]
+	if !ok {
+		return "", fmt.Errorf("mcgoweb: no route named %q", name)
+	}
+	return route.buildURL(vars, query)
+}
+
+// URLFor returns the path of the named route as with the
+// application's URLFor.  A name starting with "." refers to a
+// handler in the same blueprint as the current route.
+func (context *RequestContext) URLFor(name string, vars map[string]string, query url.Values) (string, error) {
+	if strings.HasPrefix(name, ".") && context.route != nil && context.route.namespace != "" {
+		name = context.route.namespace + name
+	}
+	name = strings.TrimPrefix(name, ".")
+	return context.application.URLFor(name, vars, query)
+}
+
+func (route *Route) buildURL(vars map[string]string, query url.Values) (string, error) {
+	used := make(map[string]bool, len(vars))
+	segments := route.pathPattern.segments
+	built_parts := make([]string, 0, len(segments))
+
+	for i, segment := range segments {
+		// Optional segments are built while their variables are given
+		if segment.depth > 0 && !optionalSegmentGiven(segments[i:], vars) {
+			break
+		}
+		var built strings.Builder
+		for _, token := range segment.tokens {
+			if token.name == "" {
+				built.WriteString(escapePath(token.literal))
+				continue
+			}
+			if token.kind == "mount" {
+				continue
+			}
+			value, ok := vars[token.name]
+			if !ok {
+				return "", fmt.Errorf("mcgoweb: missing value for %q in route %q", token.name, route.Name)
+			}
+			// Routes match the escaped path, so the escaped value
+			// is checked
+			escaped := escapeSegment(value)
+			if token.kind == "path" {
+				escaped = escapePath(value)
+			}
+			if !token.valueRE.MatchString(escaped) {
+				return "", fmt.Errorf("mcgoweb: value %q for %q in route %q does not match %s", value, token.name, route.Name, token.kind)
+			}
+			used[token.name] = true
+			built.WriteString(escaped)
+		}
+		built_parts = append(built_parts, built.String())
+	}
+	if route.hostPattern != nil {
+		for _, segment := range route.hostPattern.segments {
+			for _, token := range segment.tokens {
+				value, ok := vars[token.name]
+				if !ok || token.name == "" {
+					continue
+				}
+				if !token.valueRE.MatchString(value) {
+					return "", fmt.Errorf("mcgoweb: value %q for %q in route %q does not match %s", value, token.name, route.Name, token.kind)
+				}
+				used[token.name] = true
+			}
+		}
+	}
+	if len(used) != len(vars) {
+		var unknown []string
+		for name := range vars {
+			if !used[name] {
+				unknown = append(unknown, name)
+			}
+		}
+		sort.Strings(unknown)
+		return "", fmt.Errorf("mcgoweb: unknown variables %s for route %q", strings.Join(unknown, ", "), route.Name)
+	}
+
+	built := "/" + strings.Join(built_parts, "/")
+	if len(query) > 0 {
+		built += "?" + query.Encode()
+	}
+	return built, nil
+}
+
+// optionalSegmentGiven returns whether every variable of the first
+// segment is given, and for a segment of only literal text whether
+// a variable of a following optional segment is given.
+func optionalSegmentGiven(segments []patternSegment, vars map[string]string) bool {
+	has_variables := false
+	for _, token := range segments[0].tokens {
+		if token.name != "" {
+			if _, ok := vars[token.name]; !ok {
+				return false
+			}
+			has_variables = true
+		}
+	}
+	if has_variables {
+		return true
+	}
+	for _, segment := range segments[1:] {
+		for _, token := range segment.tokens {
+			if _, ok := vars[token.name]; ok && token.name != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func escapePath(path string) string {
+	return (&url.URL{Path: path}).EscapedPath()
+}
@@ -0,0 +1,101 @@
+package mcgoweb
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestURLFor(t *testing.T) {
+	app := NewHTTPApplication("URLFor Test", "/somewebapp", "0.0.0.0:7654")
+
+	index := NewHandler("/", HTTP_GET)
+	index.Name = "index"
+	index.RequestHandler = func(context *RequestContext) {}
+	if _, err := app.RegisterHandler(index); err != nil {
+		t.Fatalf("Unexpected error registering handler: %s", err)
+	}
+
+	var relative string
+	blueprint := NewBlueprint("/user")
+	blueprint.Name = "users"
+	show := NewHandler("/<userid:int>", HTTP_GET)
+	show.Name = "show"
+	show.RequestHandler = func(context *RequestContext) {
+		relative, _ = context.URLFor(".files", map[string]string{"userid": "17", "file": "a b/c.txt"}, nil)
+	}
+	files := NewHandler("/<userid:int>/files/<file:path>", HTTP_GET)
+	files.Name = "files"
+	files.RequestHandler = func(context *RequestContext) {}
+	blueprint.RegisterHandler(show)
+	blueprint.RegisterHandler(files)
+	if _, err := app.RegisterBlueprint(blueprint); err != nil {
+		t.Fatalf("Unexpected error registering blueprint: %s", err)
+	}
+	for name, handler_path := range map[string]string{"tag": "/tag/<tag:re:[a-z%0-9]+>", "word": "/word/<word:re:[^%]+>"} {
+		handler := NewHandler(handler_path, HTTP_GET)
+		handler.Name = name
+		handler.RequestHandler = func(context *RequestContext) {}
+		if _, err := app.RegisterHandler(handler); err != nil {
+			t.Fatalf("Unexpected error registering '%s': %s", handler_path, err)
+		}
+	}
+	tenant := NewHandler("/", HTTP_GET)
+	tenant.Name = "tenant"
+	tenant.Host = "<tenant:int>.example.com"
+	tenant.RequestHandler = func(context *RequestContext) {}
+	if _, err := app.RegisterHandler(tenant); err != nil {
+		t.Fatalf("Unexpected error registering host handler: %s", err)
+	}
+
+	urlForTest := func(t *testing.T, name string, vars map[string]string, query url.Values, expected string) {
+		if actual, err := app.URLFor(name, vars, query); err != nil {
+			t.Errorf("URLFor %q failed: %s", name, err)
+		} else if actual != expected {
+			t.Errorf("URLFor failure...\nExpected: '%s'\nActual:   '%s'", expected, actual)
+		}
+	}
+	urlForTest(t, "index", nil, nil, "/somewebapp")
+	urlForTest(t, "users.show", map[string]string{"userid": "17"}, nil, "/somewebapp/user/17")
+	urlForTest(t, "users.show", map[string]string{"userid": "17"}, url.Values{"tab": {"a&b"}}, "/somewebapp/user/17?tab=a%26b")
+	urlForTest(t, "users.files", map[string]string{"userid": "17", "file": "a b/c.txt"}, nil, "/somewebapp/user/17/files/a%20b/c.txt")
+	urlForTest(t, "tag", map[string]string{"tag": "a b"}, nil, "/somewebapp/tag/a%20b")
+	urlForTest(t, "word", map[string]string{"word": "ab"}, nil, "/somewebapp/word/ab")
+	urlForTest(t, "tenant", map[string]string{"tenant": "42"}, nil, "/somewebapp")
+
+	urlForError := func(t *testing.T, name string, vars map[string]string) {
+		if actual, err := app.URLFor(name, vars, nil); err == nil {
+			t.Errorf("Expected URLFor %q to fail, returned '%s'", name, actual)
+		}
+	}
+	urlForError(t, "show", map[string]string{"userid": "17"})
+	urlForError(t, "users.show", map[string]string{"userid": "seventeen"})
+	urlForError(t, "users.show", map[string]string{})
+	urlForError(t, "users.show", map[string]string{"userid": "17", "other": "value"})
+	urlForError(t, "word", map[string]string{"word": "a b"})
+	urlForError(t, "tenant", map[string]string{"tenant": "acme"})
+
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, createTestRequest("/somewebapp/user/17"))
+	if expected := "/somewebapp/user/17/files/a%20b/c.txt"; relative != expected {
+		t.Errorf("Relative URLFor failure...\nExpected: '%s'\nActual:   '%s'", expected, relative)
+	}
+}
+
+func TestDuplicateRouteName(t *testing.T) {
+	app := NewHTTPApplication("URLFor Test", "/", "0.0.0.0:7654")
+	first := NewHandler("/first", HTTP_GET)
+	first.Name = "page"
+	if _, err := app.RegisterHandler(first); err != nil {
+		t.Fatalf("Unexpected error registering route: %s", err)
+	}
+
+	second := NewHandler("/second", HTTP_GET)
+	second.Name = "page"
+	if _, err := app.RegisterHandler(second); err == nil {
+		t.Errorf("Expected duplicate route name to return an error")
+	}
+	if _, err := app.URLFor("page", nil, nil); err != nil {
+		t.Errorf("Unexpected error for first route: %s", err)
+	}
+}
@@ -0,0 +1,199 @@
+package mcgoweb
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// ErrUserNotFound is returned by a UserStore when no user exists
+// with the requested name.
+var ErrUserNotFound = errors.New("mcgoweb: user not found")
+
+// User represents an account which can sign in to the
+// application.  Users with a TOTPSecret must provide a second
+// factor after their password.  TOTPLastStep is the time step of
+// the last TOTP code accepted, preventing codes from being reused.
+type User struct {
+	Name          string
+	PasswordHash  string
+	TOTPSecret    string
+	TOTPLastStep  int64
+	RecoveryCodes []string
+}
+
+// UserStore provides storage of users based off the
+// user's name.
+type UserStore interface {
+	GetUser(name string) (*User, error)
+	PutUser(user *User) error
+	DeleteUser(name string) error
+}
+
+// SetPassword replaces the user's password hash with a hash of
+// the given password.
+func (user *User) SetPassword(password string, hasher *PasswordHasher) error {
+	hash, err := hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = hash
+	return nil
+}
+
+// copy returns a copy of the user which shares no slices with it.
+func (user *User) copy() *User {
+	copied := *user
+	if user.RecoveryCodes != nil {
+		copied.RecoveryCodes = append([]string(nil), user.RecoveryCodes...)
+	}
+	return &copied
+}
+
+// MemoryUserStore provides a UserStore using an in-memory
+// object.  Users will not be persisted when an application
+// goes offline.
+type MemoryUserStore struct {
+	mutex sync.RWMutex
+	users map[string]User
+}
+
+// NewMemoryUserStore returns a new empty MemoryUserStore.
+func NewMemoryUserStore() UserStore {
+	store := new(MemoryUserStore)
+	store.users = make(map[string]User)
+	return store
+}
+
+// GetUser returns a copy of the named user, or ErrUserNotFound.
+// Changes to the copy are kept only once stored with PutUser.
+func (store *MemoryUserStore) GetUser(name string) (*User, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	user, ok := store.users[name]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return user.copy(), nil
+}
+
+// PutUser stores a copy of the user, replacing any user with the
+// same name.
+func (store *MemoryUserStore) PutUser(user *User) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.users[user.Name] = *user.copy()
+	return nil
+}
+
+// DeleteUser removes the named user, or returns ErrUserNotFound.
+func (store *MemoryUserStore) DeleteUser(name string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if _, ok := store.users[name]; !ok {
+		return ErrUserNotFound
+	}
+	delete(store.users, name)
+	return nil
+}
+
+// FileUserStore provides a UserStore persisted as a JSON file.
+// The whole file is rewritten on every change, so it is intended
+// for the small number of accounts of a management console.
+type FileUserStore struct {
+	MemoryUserStore
+	path string
+}
+
+// NewFileUserStore returns a FileUserStore backed by the file at
+// the given path.  The file is created on the first change if it
+// does not exist.
+func NewFileUserStore(path string) (UserStore, error) {
+	store := new(FileUserStore)
+	store.path = path
+	store.users = make(map[string]User)
+
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var users []User
+	if err := json.Unmarshal(contents, &users); err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		store.users[user.Name] = user
+	}
+	return store, nil
+}
+
+// PutUser stores a copy of the user and rewrites the file.
+func (store *FileUserStore) PutUser(user *User) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	previous, existed := store.users[user.Name]
+	store.users[user.Name] = *user.copy()
+	if err := store.save(); err != nil {
+		if existed {
+			store.users[user.Name] = previous
+		} else {
+			delete(store.users, user.Name)
+		}
+		return err
+	}
+	return nil
+}
+
+// DeleteUser removes the named user and rewrites the file.
+func (store *FileUserStore) DeleteUser(name string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	user, ok := store.users[name]
+	if !ok {
+		return ErrUserNotFound
+	}
+	delete(store.users, name)
+	if err := store.save(); err != nil {
+		store.users[name] = user
+		return err
+	}
+	return nil
+}
+
+// save writes all users to a temporary file which replaces the
+// store's file, so a failed write never loses existing users.
+func (store *FileUserStore) save() error {
+	users := make([]User, 0, len(store.users))
+	for _, user := range store.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+	contents, err := json.MarshalIndent(users, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(store.path), ".users")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(contents); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Chmod(0600); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), store.path)
+}
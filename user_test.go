@@ -0,0 +1,86 @@
+package mcgoweb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPasswordHasher(t *testing.T) {
+	weak := &PasswordHasher{Iterations: 10, SaltLength: 8, KeyLength: 16}
+	strong := &PasswordHasher{Iterations: 20, SaltLength: 16, KeyLength: 32}
+
+	hash, err := weak.Hash("correct horse")
+	if err != nil {
+		t.Fatalf("Unexpected hash error: %s", err)
+	}
+	if ok, err := strong.Verify("correct horse", hash); !ok || err != nil {
+		t.Errorf("Password not verified with hash parameters: %v", err)
+	}
+	if ok, _ := strong.Verify("battery staple", hash); ok {
+		t.Errorf("Wrong password verified")
+	}
+	if weak.NeedsUpgrade(hash) {
+		t.Errorf("Hash unexpectedly needs upgrade with same parameters")
+	}
+	if !strong.NeedsUpgrade(hash) {
+		t.Errorf("Hash with weaker parameters does not need upgrade")
+	}
+	if _, err := strong.Verify("correct horse", "plaintext"); err != ErrInvalidPasswordHash {
+		t.Errorf("Unexpected error %v, expected %v", err, ErrInvalidPasswordHash)
+	}
+}
+
+func TestFileUserStore(t *testing.T) {
+	directory, err := ioutil.TempDir("", "mcgoweb-users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	path := filepath.Join(directory, "users.json")
+
+	store, err := NewFileUserStore(path)
+	if err != nil {
+		t.Fatalf("Unexpected error creating store: %s", err)
+	}
+	if _, err := store.GetUser("admin"); err != ErrUserNotFound {
+		t.Errorf("Unexpected error %v, expected %v", err, ErrUserNotFound)
+	}
+	store.PutUser(&User{Name: "admin", PasswordHash: "hash1"})
+	store.PutUser(&User{Name: "operator", PasswordHash: "hash2"})
+	store.DeleteUser("operator")
+
+	reopened, err := NewFileUserStore(path)
+	if err != nil {
+		t.Fatalf("Unexpected error reopening store: %s", err)
+	}
+	user, err := reopened.GetUser("admin")
+	if err != nil {
+		t.Fatalf("Unexpected error getting user: %s", err)
+	}
+	if expected := "hash1"; user.PasswordHash != expected {
+		t.Errorf("Unexpected password hash...\nExpected: '%s'\nActual: '%s'", expected, user.PasswordHash)
+	}
+	if _, err := reopened.GetUser("operator"); err != ErrUserNotFound {
+		t.Errorf("Deleted user persisted in store")
+	}
+}
+
+func TestMemoryUserStoreCopies(t *testing.T) {
+	users := NewMemoryUserStore()
+	user := &User{Name: "admin", RecoveryCodes: []string{"a", "b"}}
+	if err := users.PutUser(user); err != nil {
+		t.Fatalf("Unexpected error storing user: %s", err)
+	}
+	user.RecoveryCodes[0] = "changed"
+
+	stored, err := users.GetUser("admin")
+	if err != nil {
+		t.Fatalf("Unexpected error getting user: %s", err)
+	}
+	stored.RecoveryCodes[1] = "changed"
+	if stored, _ := users.GetUser("admin"); stored.RecoveryCodes[0] != "a" || stored.RecoveryCodes[1] != "b" {
+		t.Errorf("Stored recovery codes changed through a copy: %v", stored.RecoveryCodes)
+	}
+}
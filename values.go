@@ -0,0 +1,100 @@
+package mcgoweb
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Key is a typed key for values stored on a RequestContext,
+// letting middleware pass data to the handlers they call without
+// colliding with request variables or other middleware.  Keys are
+// compared by identity, so each key should be created once, usually
+// as a package variable.
+type Key[T any] struct {
+	name string
+}
+
+// NewKey returns a new key for values of type T.  The name is used
+// in error messages.
+func NewKey[T any](name string) *Key[T] {
+	return &Key[T]{name: name}
+}
+
+// String returns the name of the key.
+func (key *Key[T]) String() string {
+	return key.name
+}
+
+// Set stores the value for the key on the request context.
+func (key *Key[T]) Set(context *RequestContext, value T) {
+	values := context.valueStore()
+	values.lock.Lock()
+	values.values[key] = value
+	values.lock.Unlock()
+}
+
+// Get returns the value stored for the key on the request context
+// and whether it was set.
+func (key *Key[T]) Get(context *RequestContext) (T, bool) {
+	var value T
+	if context.values == nil {
+		return value, false
+	}
+	context.values.lock.Lock()
+	stored, ok := context.values.values[key]
+	context.values.lock.Unlock()
+	if ok {
+		// A nil interface value stored for an interface type does
+		// not assert to T
+		value, _ = stored.(T)
+	}
+	return value, ok
+}
+
+// MustGet returns the value stored for the key on the request
+// context, panicking if it was not set.
+func (key *Key[T]) MustGet(context *RequestContext) T {
+	value, ok := key.Get(context)
+	if !ok {
+		panic(fmt.Sprintf("mcgoweb: request value %q not set", key.name))
+	}
+	return value
+}
+
+// Delete removes the value stored for the key from the request
+// context.
+func (key *Key[T]) Delete(context *RequestContext) {
+	if context.values == nil {
+		return
+	}
+	context.values.lock.Lock()
+	delete(context.values.values, key)
+	context.values.lock.Unlock()
+}
+
+// requestValues holds the values stored on a request context,
+// shared by copies of the context.
+type requestValues struct {
+	lock   sync.Mutex
+	values map[interface{}]interface{}
+}
+
+func (values *requestValues) clone() *requestValues {
+	if values == nil {
+		return nil
+	}
+	values.lock.Lock()
+	defer values.lock.Unlock()
+	cloned := &requestValues{values: make(map[interface{}]interface{}, len(values.values))}
+	for key, value := range values.values {
+		cloned.values[key] = value
+	}
+	return cloned
+}
+
+func (context *RequestContext) valueStore() *requestValues {
+	if context.values == nil {
+		context.values = &requestValues{values: make(map[interface{}]interface{})}
+	}
+	return context.values
+}
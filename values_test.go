@@ -0,0 +1,62 @@
+package mcgoweb
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type valuesTestUser struct {
+	Name string
+}
+
+var valuesTestUserKey = NewKey[*valuesTestUser]("user")
+var valuesTestCountKey = NewKey[int]("count")
+
+func TestRequestValues(t *testing.T) {
+	var user *valuesTestUser
+	var count int
+	var count_set bool
+	app := NewHTTPApplication("Values Test", "/", "0.0.0.0:7654")
+	app.AddMiddleware(func(handler RequestHandler, context *RequestContext) {
+		valuesTestUserKey.Set(context, &valuesTestUser{Name: context.RequestVars["name"]})
+		handler(context)
+		count, count_set = valuesTestCountKey.Get(context)
+	})
+	handler := NewHandler("/users/<name>", HTTP_GET)
+	handler.Timeout = time.Minute
+	handler.RequestHandler = func(context *RequestContext) {
+		user = valuesTestUserKey.MustGet(context)
+		valuesTestCountKey.Set(context, 3)
+	}
+	if _, err := app.RegisterHandler(handler); err != nil {
+		t.Fatalf("Unexpected error registering handler: %s", err)
+	}
+
+	app.ServeHTTP(httptest.NewRecorder(), createTestRequest("/users/alice"))
+	if user == nil || user.Name != "alice" {
+		t.Errorf("Unexpected user %v", user)
+	}
+	if !count_set || count != 3 {
+		t.Errorf("Expected value set by handler to be visible to middleware, got %d, %t", count, count_set)
+	}
+
+	context := new(RequestContext)
+	if _, ok := valuesTestCountKey.Get(context); ok {
+		t.Errorf("Expected value to be unset on a new context")
+	}
+	valuesTestCountKey.Set(context, 1)
+	valuesTestCountKey.Delete(context)
+
+	error_key := NewKey[error]("error")
+	error_key.Set(context, nil)
+	if err, ok := error_key.Get(context); !ok || err != nil {
+		t.Errorf("Unexpected value %v, %t for nil interface value", err, ok)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected MustGet of an unset value to panic")
+		}
+	}()
+	valuesTestCountKey.MustGet(context)
+}
@@ -0,0 +1,251 @@
+package mcgoweb
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// VersionByPath, VersionByAccept and VersionByHeader select the
+// version of a VersionedBlueprint handling a request.  By path,
+// each version is served below a prefix such as "/v2".  By accept,
+// the version is a parameter of the Accept header's media type,
+// such as "application/json; version=2".  By header, the version
+// is the value of a request header.
+const (
+	VersionByPath   = "path"
+	VersionByAccept = "accept"
+	VersionByHeader = "header"
+)
+
+// DefaultVersionHeader and DefaultVersionParameter are used to
+// select versions when a VersionedBlueprint does not set its own.
+const (
+	DefaultVersionHeader    = "API-Version"
+	DefaultVersionParameter = "version"
+)
+
+// APIVersion represents a version of a versioned API.  A deprecated
+// version adds a Deprecation header to its responses, along with a
+// Sunset header for the time it will be removed and a Link header
+// to the deprecation's documentation when they are set.
+type APIVersion struct {
+	Name       string
+	Blueprint  *Blueprint
+	Deprecated time.Time
+	Sunset     time.Time
+	Link       string
+}
+
+// VersionedBlueprint represents the versions of an API served
+// side by side.  Versions are added oldest first, and each version
+// falls back to the handlers of previous versions for any path and
+// method it does not handle itself.  When the version is selected
+// by Accept or header, requests not selecting a version are handled
+// by the Default version, or the latest version if not set.
+type VersionedBlueprint struct {
+	Name      string
+	Path      string
+	Selector  string
+	Header    string
+	Parameter string
+	Default   string
+	Versions  []*APIVersion
+}
+
+// NewVersionedBlueprint returns a new versioned blueprint at the
+// given path, selecting versions with the selector.
+func NewVersionedBlueprint(path, selector string) *VersionedBlueprint {
+	return &VersionedBlueprint{
+		Path:      path,
+		Selector:  selector,
+		Header:    DefaultVersionHeader,
+		Parameter: DefaultVersionParameter,
+	}
+}
+
+// AddVersion adds a version served by the blueprint, newer than any
+// version already added.
+func (versioned *VersionedBlueprint) AddVersion(name string, blueprint *Blueprint) *APIVersion {
+	version := &APIVersion{Name: name, Blueprint: blueprint}
+	versioned.Versions = append(versioned.Versions, version)
+	return version
+}
+
+// Blueprint returns the blueprint serving every version, to be
+// registered with an application.  Each version is a nested
+// blueprint named after the version, so handler names are
+// namespaced such as "api.v2.users".
+func (versioned *VersionedBlueprint) Blueprint() (*Blueprint, error) {
+	switch versioned.Selector {
+	case VersionByPath, VersionByAccept, VersionByHeader:
+	default:
+		return nil, fmt.Errorf("mcgoweb: unknown version selector %q", versioned.Selector)
+	}
+	if len(versioned.Versions) == 0 {
+		return nil, fmt.Errorf("mcgoweb: versioned blueprint %s has no versions", versioned.Path)
+	}
+	default_version := versioned.Default
+	if default_version == "" {
+		default_version = versioned.Versions[len(versioned.Versions)-1].Name
+	}
+
+	blueprint := NewBlueprint(versioned.Path)
+	blueprint.Name = versioned.Name
+	for i, version := range versioned.Versions {
+		version_blueprint := NewBlueprint("/")
+		version_blueprint.Name = version.Name
+		switch versioned.Selector {
+		case VersionByPath:
+			version_blueprint.Path = "/" + version.Name
+		case VersionByAccept:
+			version_blueprint.Conditions = []Condition{acceptVersionCondition(versioned.Parameter, version.Name, version.Name == default_version)}
+			version_blueprint.AddMiddleware(varyMiddleware("Accept"))
+		case VersionByHeader:
+			version_blueprint.Conditions = []Condition{headerVersionCondition(versioned.Header, version.Name, version.Name == default_version)}
+			version_blueprint.AddMiddleware(varyMiddleware(versioned.Header))
+		}
+		if !version.Deprecated.IsZero() {
+			version_blueprint.AddMiddleware(deprecationMiddleware(version))
+		}
+
+		version_blueprint.RegisterBlueprint(copyBlueprint(version.Blueprint))
+		newer := []*Blueprint{version.Blueprint}
+		for j := i - 1; j >= 0; j-- {
+			fallback := fallbackBlueprint(versioned.Versions[j].Blueprint, newer)
+			fallback.Name, fallback.Path = version.Blueprint.Name, version.Blueprint.Path
+			version_blueprint.RegisterBlueprint(fallback)
+			newer = append(newer, versioned.Versions[j].Blueprint)
+		}
+		blueprint.RegisterBlueprint(version_blueprint)
+	}
+	return blueprint, nil
+}
+
+// copyBlueprint returns a copy of the blueprint and its nested
+// blueprints, so registering it leaves the original's parent unset.
+func copyBlueprint(blueprint *Blueprint) *Blueprint {
+	copied := new(Blueprint)
+	*copied = *blueprint
+	copied.parent = nil
+	copied.Blueprints = nil
+	for _, nested := range blueprint.Blueprints {
+		copied.RegisterBlueprint(copyBlueprint(nested))
+	}
+	return copied
+}
+
+// fallbackBlueprint returns a copy of the older blueprint without
+// the methods of handlers at routes handled by the newer blueprints,
+// matching handlers by the signature of their path and host, so
+// "/items/<id:int>" replaces "/items/<item:int>", and nested
+// blueprints by the signature of their path.
+func fallbackBlueprint(older *Blueprint, newer []*Blueprint) *Blueprint {
+	fallback := new(Blueprint)
+	*fallback = *older
+	fallback.parent = nil
+	fallback.Handlers = nil
+	fallback.Blueprints = nil
+
+	for _, handler := range older.Handlers {
+		methods, name := handler.HTTPMethods, handler.Name
+		for _, newer_blueprint := range newer {
+			for _, newer_handler := range newer_blueprint.Handlers {
+				if handlerSignature(newer_handler) == handlerSignature(handler) {
+					methods &^= newer_handler.HTTPMethods
+				}
+				if newer_handler.Name == name {
+					name = ""
+				}
+			}
+		}
+		if methods != 0 {
+			fallback_handler := new(Handler)
+			*fallback_handler = *handler
+			fallback_handler.HTTPMethods = methods
+			fallback_handler.Name = name
+			fallback.Handlers = append(fallback.Handlers, fallback_handler)
+		}
+	}
+	for _, nested := range older.Blueprints {
+		var newer_nested []*Blueprint
+		for _, newer_blueprint := range newer {
+			for _, candidate := range newer_blueprint.Blueprints {
+				if pathSignature(strings.TrimRight(candidate.Path, "/")) == pathSignature(strings.TrimRight(nested.Path, "/")) {
+					newer_nested = append(newer_nested, candidate)
+				}
+			}
+		}
+		fallback.RegisterBlueprint(fallbackBlueprint(nested, newer_nested))
+	}
+	return fallback
+}
+
+// handlerSignature returns the signature of the route for a handler
+// within its blueprint.
+func handlerSignature(handler *Handler) string {
+	signature := pathSignature(handler.Path)
+	if handler.Host != "" {
+		if pattern, err := parseHostPattern(handler.Host); err == nil {
+			return strings.ToLower(pattern.signature) + signature
+		}
+		return handler.Host + signature
+	}
+	return signature
+}
+
+// pathSignature returns the signature of a path pattern, or the
+// path itself if it is invalid.
+func pathSignature(path string) string {
+	if pattern, err := parsePathPattern(path); err == nil {
+		return pattern.signature
+	}
+	return path
+}
+
+func acceptVersionCondition(parameter, version string, is_default bool) Condition {
+	return func(context *RequestContext) bool {
+		for _, item := range splitHeaderList(context.Request.Header.Values("Accept")) {
+			if _, params, err := mime.ParseMediaType(item); err == nil {
+				if requested, ok := params[parameter]; ok {
+					return requested == version
+				}
+			}
+		}
+		return is_default
+	}
+}
+
+func headerVersionCondition(header, version string, is_default bool) Condition {
+	return func(context *RequestContext) bool {
+		if requested := strings.TrimSpace(context.Request.Header.Get(header)); requested != "" {
+			return requested == version
+		}
+		return is_default
+	}
+}
+
+func varyMiddleware(header string) Middleware {
+	return func(handler RequestHandler, context *RequestContext) {
+		context.Writer.Header().Add("Vary", header)
+		handler(context)
+	}
+}
+
+// deprecationMiddleware adds the RFC 9745 Deprecation header and
+// RFC 8594 Sunset header for a deprecated version.
+func deprecationMiddleware(version *APIVersion) Middleware {
+	return func(handler RequestHandler, context *RequestContext) {
+		header := context.Writer.Header()
+		header.Set("Deprecation", fmt.Sprintf("@%d", version.Deprecated.Unix()))
+		if !version.Sunset.IsZero() {
+			header.Set("Sunset", version.Sunset.UTC().Format(http.TimeFormat))
+		}
+		if version.Link != "" {
+			header.Add("Link", "<"+version.Link+">; rel=\"deprecation\"")
+		}
+		handler(context)
+	}
+}
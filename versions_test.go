@@ -0,0 +1,149 @@
+package mcgoweb
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newVersionTestBlueprints() (*Blueprint, *Blueprint) {
+	writer := func(body string) RequestHandler {
+		return func(context *RequestContext) {
+			context.Writer.Write([]byte(body))
+		}
+	}
+	v1 := NewBlueprint("/")
+	v1.Name = "users"
+	list := NewHandler("/users", HTTP_GET|HTTP_POST)
+	list.Name = "list"
+	list.RequestHandler = writer("v1 list")
+	show := NewHandler("/users/<id:int>", HTTP_GET)
+	show.Name = "show"
+	show.RequestHandler = writer("v1 show")
+	v1.RegisterHandler(list)
+	v1.RegisterHandler(show)
+
+	v2 := NewBlueprint("/")
+	v2.Name = "users"
+	list2 := NewHandler("/users", HTTP_GET)
+	list2.Name = "list"
+	list2.RequestHandler = writer("v2 list")
+	v2.RegisterHandler(list2)
+	return v1, v2
+}
+
+func TestVersionedBlueprintByPath(t *testing.T) {
+	v1, v2 := newVersionTestBlueprints()
+	versioned := NewVersionedBlueprint("/api", VersionByPath)
+	versioned.Name = "api"
+	deprecated := versioned.AddVersion("v1", v1)
+	deprecated.Deprecated = time.Unix(1700000000, 0)
+	deprecated.Sunset = time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	deprecated.Link = "https://example.com/deprecation"
+	versioned.AddVersion("v2", v2)
+	v3 := NewBlueprint("/")
+	show3 := NewHandler("users/<user:int>", HTTP_GET)
+	show3.RequestHandler = func(context *RequestContext) {
+		context.Writer.Write([]byte("v3 show"))
+	}
+	v3.RegisterHandler(show3)
+	versioned.AddVersion("v3", v3)
+
+	blueprint, err := versioned.Blueprint()
+	if err != nil {
+		t.Fatalf("Unexpected error building blueprint: %s", err)
+	}
+	if v1.parent != nil || v2.parent != nil {
+		t.Errorf("Expected version blueprints to be left unregistered")
+	}
+	app := NewHTTPApplication("Version Test", "/", "0.0.0.0:7654")
+	if _, err := app.RegisterBlueprint(blueprint); err != nil {
+		t.Fatalf("Unexpected error registering blueprint: %s", err)
+	}
+
+	versionTest := func(t *testing.T, method, path string, expected string) *httptest.ResponseRecorder {
+		request := createTestRequest(path)
+		request.Method = method
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		if actual := response.Body.String(); actual != expected {
+			t.Errorf("Unexpected response for %s %s\nExpected: '%s'\nActual:   '%s'", method, path, expected, actual)
+		}
+		return response
+	}
+	response := versionTest(t, "GET", "/api/v1/users", "v1 list")
+	if actual, expected := response.Header().Get("Deprecation"), "@1700000000"; actual != expected {
+		t.Errorf("Unexpected Deprecation header '%s', expected '%s'", actual, expected)
+	}
+	if actual, expected := response.Header().Get("Sunset"), "Tue, 01 Jan 2030 00:00:00 GMT"; actual != expected {
+		t.Errorf("Unexpected Sunset header '%s', expected '%s'", actual, expected)
+	}
+	if actual, expected := response.Header().Get("Link"), `<https://example.com/deprecation>; rel="deprecation"`; actual != expected {
+		t.Errorf("Unexpected Link header '%s', expected '%s'", actual, expected)
+	}
+
+	response = versionTest(t, "GET", "/api/v2/users", "v2 list")
+	if actual := response.Header().Get("Deprecation"); actual != "" {
+		t.Errorf("Unexpected Deprecation header '%s' for current version", actual)
+	}
+	versionTest(t, "POST", "/api/v2/users", "v1 list")
+	versionTest(t, "GET", "/api/v2/users/3", "v1 show")
+	versionTest(t, "GET", "/api/v3/users/3", "v3 show")
+	versionTest(t, "GET", "/api/v3/users", "v2 list")
+
+	if actual, err := app.URLFor("api.v2.users.show", map[string]string{"id": "3"}, nil); err != nil {
+		t.Errorf("URLFor failed: %s", err)
+	} else if expected := "/api/v2/users/3"; actual != expected {
+		t.Errorf("URLFor failure...\nExpected: '%s'\nActual:   '%s'", expected, actual)
+	}
+}
+
+func TestVersionedBlueprintBySelector(t *testing.T) {
+	for _, selector := range []string{VersionByAccept, VersionByHeader} {
+		v1, v2 := newVersionTestBlueprints()
+		versioned := NewVersionedBlueprint("/api", selector)
+		versioned.AddVersion("1", v1)
+		versioned.AddVersion("2", v2)
+		blueprint, err := versioned.Blueprint()
+		if err != nil {
+			t.Fatalf("Unexpected error building blueprint: %s", err)
+		}
+		app := NewHTTPApplication("Version Test", "/", "0.0.0.0:7654")
+		if _, err := app.RegisterBlueprint(blueprint); err != nil {
+			t.Fatalf("Unexpected error registering %s blueprint: %s", selector, err)
+		}
+
+		versionTest := func(t *testing.T, path, version, expected string) {
+			request := createTestRequest(path)
+			request.Header = make(map[string][]string)
+			if version != "" {
+				if selector == VersionByAccept {
+					request.Header.Set("Accept", "application/json; version="+version)
+				} else {
+					request.Header.Set(DefaultVersionHeader, version)
+				}
+			}
+			response := httptest.NewRecorder()
+			app.ServeHTTP(response, request)
+			if actual := response.Body.String(); actual != expected {
+				t.Errorf("Unexpected %s response for %s version %q\nExpected: '%s'\nActual:   '%s'", selector, path, version, expected, actual)
+			}
+			if response.Code == 200 && response.Header().Get("Vary") == "" {
+				t.Errorf("Expected Vary header on %s response", selector)
+			}
+		}
+		versionTest(t, "/api/users", "1", "v1 list")
+		versionTest(t, "/api/users", "2", "v2 list")
+		versionTest(t, "/api/users", "", "v2 list")
+		versionTest(t, "/api/users/3", "2", "v1 show")
+		versionTest(t, "/api/users", "3", "404 page not found\n")
+	}
+}
+
+func TestVersionedBlueprintSelector(t *testing.T) {
+	versioned := NewVersionedBlueprint("/api", "cookie")
+	versioned.AddVersion("v1", NewBlueprint("/"))
+	if _, err := versioned.Blueprint(); err == nil {
+		t.Errorf("Expected unknown version selector to return an error")
+	}
+}